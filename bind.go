@@ -0,0 +1,158 @@
+package pungi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Struct tag holding the key name. `pungi:"-"` skips the field.
+	keyTag = "pungi"
+	// Struct tag holding the key description.
+	descTag = "desc"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	valueType    = reflect.TypeOf((*Value)(nil)).Elem()
+)
+
+// Populates the struct pointed by `target` from this configuration.
+// Fields are matched to keys by the `pungi` tag, untagged fields use the field name starting with a lower case letter.
+// Fields without a declared key and values that can't be converted are errors.
+//
+//	type HttpConf struct {
+//		Port    int           `pungi:"port"`
+//		Timeout time.Duration `pungi:"timeout"`
+//	}
+func (c *Conf) Bind(target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("Bind expects a pointer to a struct, got %T", target)
+	}
+	rv = rv.Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		name, ok := fieldKeyName(field)
+		if !ok {
+			continue
+		}
+		if err := c.bindField(name, rv.Field(i)); err != nil {
+			return errors.Wrapf(err, "field %s", field.Name)
+		}
+	}
+	return nil
+}
+
+// Returns `*UndeclaredKeyError` for fields without a declared key and `*ConversionError` for invalid values.
+func (c *Conf) bindField(key string, field reflect.Value) error {
+	if _, err := c.declaredName(key); err != nil {
+		return err
+	}
+	if field.Addr().Type().Implements(valueType) {
+		return c.GetValue(key, field.Addr().Interface().(Value))
+	}
+	var value interface{}
+	var err error
+	switch field.Type() {
+	case durationType:
+		value, err = c.GetDurationE(key)
+	case timeType:
+		value, err = c.GetTimeE(key)
+	case reflect.TypeOf([]string{}):
+		value, err = c.GetStringSliceE(key)
+	case reflect.TypeOf([]int{}):
+		value, err = c.GetIntSliceE(key)
+	case reflect.TypeOf(map[string]string{}):
+		value, err = c.GetStringMapE(key)
+	default:
+		switch field.Kind() {
+		case reflect.String:
+			value, err = c.GetStringE(key)
+		case reflect.Int:
+			value, err = c.GetIntE(key)
+		case reflect.Int64:
+			value, err = c.GetInt64E(key)
+		case reflect.Uint:
+			value, err = c.GetUintE(key)
+		case reflect.Uint64:
+			value, err = c.GetUint64E(key)
+		case reflect.Bool:
+			value, err = c.GetBoolE(key)
+		case reflect.Float64:
+			value, err = c.GetFloat64E(key)
+		default:
+			return errors.New("Not suppored value type: " + field.Type().String())
+		}
+	}
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(value).Convert(field.Type()))
+	return nil
+}
+
+// Builds keys from the fields of a struct. Field values are the defaults, `desc` tag is the description.
+func keysFrom(defaults interface{}) ([]*key, error) {
+	rv := reflect.ValueOf(defaults)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.Errorf("KeysFrom expects a struct, got %T", defaults)
+	}
+	var keys []*key
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		name, ok := fieldKeyName(field)
+		if !ok {
+			continue
+		}
+		value := rv.Field(i).Interface()
+		if reflect.PtrTo(field.Type).Implements(valueType) {
+			copied := reflect.New(field.Type)
+			copied.Elem().Set(rv.Field(i))
+			value = copied.Interface()
+		}
+		var options []KeyOption
+		if hasTagOption(field, "required") {
+			options = append(options, Required())
+		}
+		if hasTagOption(field, "sensitive") {
+			options = append(options, Sensitive())
+		}
+		keys = append(keys, newKey(name, value, field.Tag.Get(descTag), options))
+	}
+	return keys, nil
+}
+
+func fieldKeyName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false // unexported
+	}
+	tag := field.Tag.Get(keyTag)
+	if tag == "-" {
+		return "", false
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+	r, size := utf8.DecodeRuneInString(field.Name)
+	return string(unicode.ToLower(r)) + field.Name[size:], true
+}
+
+// Tag options follow the key name: `pungi:"port,required"`
+func hasTagOption(field reflect.StructField, option string) bool {
+	for _, o := range strings.Split(field.Tag.Get(keyTag), ",")[1:] {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
@@ -5,20 +5,47 @@ import "github.com/spf13/cobra"
 // Command defines one command
 type Command struct {
 	cmdName, usageText, desc string
-	runnable                 Runnable
+	runnable                 RunnableContext
+	handleSignals            bool
 	keys                     map[string]*key
 	args                     cobra.PositionalArgs
+	commands                 map[string]*Command
+	// First error from building, returned by `Initialize`
+	err error
 }
 
-func (c *Command) Key(name string, value interface{}, desc string) *Command {
-	c.keys[name] = &key{
-		name:  name,
-		value: value,
-		desc:  desc,
+// Defines a command specific key. Options add validation rules, e.g. `pungi.Min(1)`.
+func (c *Command) Key(name string, value interface{}, desc string, options ...KeyOption) *Command {
+	c.keys[name] = newKey(name, value, desc, options)
+	return c
+}
+
+// Defines keys from the fields of a struct. Field values are used as defaults.
+// Key names are taken from the `pungi` tag and descriptions from the `desc` tag.
+//
+//	type GrpcConf struct {
+//		Port  int    `pungi:"port" desc:"Service listen port."`
+//		DbUri string `pungi:"dbUri" desc:"Db Uri"`
+//	}
+//	pungi.Cmd("grpc", "Starts gRPC service.", startGrpc).KeysFrom(GrpcConf{Port: 5432, DbUri: "boltdb:db/my.db"})
+func (c *Command) KeysFrom(defaults interface{}) *Command {
+	keys, err := keysFrom(defaults)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	for _, key := range keys {
+		c.keys[key.name] = key
 	}
 	return c
 }
 
+// Defines a subcommand. Subcommands inherit the keys of this command.
+// The config file section of the subcommand (`[app.db.migrate]`) overrides the section of this command (`[app.db]`).
+func (c *Command) Cmd(command *Command) *Command {
+	c.commands[command.cmdName] = command
+	return c
+}
+
 func (c *Command) Args(args cobra.PositionalArgs) *Command {
 	c.args = args
 	return c
@@ -29,7 +56,8 @@ func Cmd(usageText, desc string, runnable func(conf *Conf, args []string) error)
 		cmdName:   firstWord(usageText),
 		usageText: usageText,
 		desc:      desc,
-		runnable:  runnable,
+		runnable:  withoutContext(runnable),
 		keys:      make(map[string]*key),
+		commands:  make(map[string]*Command),
 	}
 }
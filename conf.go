@@ -4,14 +4,58 @@ import (
 	"fmt"
 
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/spf13/viper"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
 )
 
-// Conf is configuration that's related to one specific command
+// Conf is configuration that's related to one specific command.
+// Values are read from the configuration store of the Pungi that created it.
 type Conf struct {
 	cmdName string
 	appName string
+	store   *configStore
+	// Keys defined for this command, including the root keys
+	keys map[string]*boundKey
+	// Declared keys read with the getters, see `UnreadKeys`
+	readMu sync.Mutex
+	reads  map[string]bool
+}
+
+func newConf(appName, cmdName string, store *configStore) *Conf {
+	return &Conf{
+		appName: appName,
+		cmdName: cmdName,
+		store:   store,
+		keys:    make(map[string]*boundKey),
+		reads:   make(map[string]bool),
+	}
+}
+
+// Returns a copy reading from another store, e.g. one staged for a reload.
+func (c *Conf) withStore(store *configStore) *Conf {
+	if store == c.store {
+		return c
+	}
+	conf := newConf(c.appName, c.cmdName, store)
+	conf.keys = c.keys
+	return conf
+}
+
+// Config file paths of the key, from the command section up to the app section.
+// E.g. `app.db.migrate.port`, `app.db.port`, `app.port`
+func (c *Conf) fileKeys(key string) []string {
+	fileKeys := []string{c.fullKey(key)}
+	path := strings.Fields(c.cmdName)
+	for i := len(path) - 1; i > 0; i-- {
+		fileKeys = append(fileKeys, formatCommandConfKey(c.appName, strings.Join(path[:i], " "), key))
+	}
+	if c.cmdName != "" {
+		fileKeys = append(fileKeys, formatRootConfKey(c.appName, key))
+	}
+	return fileKeys
 }
 
 func (c *Conf) fullKey(key string) string {
@@ -22,56 +66,210 @@ func (c *Conf) fullKey(key string) string {
 }
 
 func (c *Conf) GetBool(key string) bool {
-	return viper.GetViper().GetBool(c.fullKey(key))
+	return cast.ToBool(c.read(key))
 }
 func (c *Conf) GetInt(key string) int {
-	return viper.GetViper().GetInt(c.fullKey(key))
+	return cast.ToInt(c.read(key))
 }
 func (c *Conf) GetFloat64(key string) float64 {
-	return viper.GetViper().GetFloat64(c.fullKey(key))
+	return cast.ToFloat64(c.read(key))
 }
 func (c *Conf) GetString(key string) string {
-	return viper.GetViper().GetString(c.fullKey(key))
+	return cast.ToString(c.read(key))
+}
+func (c *Conf) GetInt64(key string) int64 {
+	return cast.ToInt64(c.read(key))
+}
+func (c *Conf) GetUint(key string) uint {
+	return cast.ToUint(c.read(key))
+}
+func (c *Conf) GetUint64(key string) uint64 {
+	return cast.ToUint64(c.read(key))
+}
+func (c *Conf) GetDuration(key string) time.Duration {
+	return cast.ToDuration(c.read(key))
+}
+func (c *Conf) GetTime(key string) time.Time {
+	return cast.ToTime(c.read(key))
+}
+
+// Env variables are comma separated: `TESTAPP_ORIGINS=a.com,b.com`
+func (c *Conf) GetStringSlice(key string) []string {
+	return toStringSlice(c.read(key))
+}
+
+// Env variables are comma separated: `TESTAPP_PORTS=80,443`
+func (c *Conf) GetIntSlice(key string) []int {
+	return toIntSlice(c.read(key))
+}
+
+// Env variables are comma separated pairs: `TESTAPP_LABELS=team=music,tier=web`
+func (c *Conf) GetStringMap(key string) map[string]string {
+	return toStringMap(c.read(key))
+}
+
+// The `E` getters return `*UndeclaredKeyError` when the key is not declared on the builder or the command
+// and `*ConversionError` when the value can't be converted to the type of the getter.
+// With `Interpolate` references that can't be expanded are returned as `*InterpolationError`.
+func (c *Conf) GetBoolE(key string) (bool, error) {
+	value, err := c.getE(key, false)
+	return value.(bool), err
+}
+func (c *Conf) GetIntE(key string) (int, error) {
+	value, err := c.getE(key, 0)
+	return value.(int), err
+}
+func (c *Conf) GetFloat64E(key string) (float64, error) {
+	value, err := c.getE(key, 0.0)
+	return value.(float64), err
+}
+func (c *Conf) GetStringE(key string) (string, error) {
+	value, err := c.getE(key, "")
+	return value.(string), err
+}
+func (c *Conf) GetInt64E(key string) (int64, error) {
+	value, err := c.getE(key, int64(0))
+	return value.(int64), err
+}
+func (c *Conf) GetUintE(key string) (uint, error) {
+	value, err := c.getE(key, uint(0))
+	return value.(uint), err
+}
+func (c *Conf) GetUint64E(key string) (uint64, error) {
+	value, err := c.getE(key, uint64(0))
+	return value.(uint64), err
+}
+func (c *Conf) GetDurationE(key string) (time.Duration, error) {
+	value, err := c.getE(key, time.Duration(0))
+	return value.(time.Duration), err
 }
+func (c *Conf) GetTimeE(key string) (time.Time, error) {
+	value, err := c.getE(key, time.Time{})
+	return value.(time.Time), err
+}
+func (c *Conf) GetStringSliceE(key string) ([]string, error) {
+	value, err := c.getE(key, []string(nil))
+	return value.([]string), err
+}
+func (c *Conf) GetIntSliceE(key string) ([]int, error) {
+	value, err := c.getE(key, []int(nil))
+	return value.([]int), err
+}
+func (c *Conf) GetStringMapE(key string) (map[string]string, error) {
+	value, err := c.getE(key, map[string]string(nil))
+	return value.(map[string]string), err
+}
+
+// Parses the value of a custom typed key into `dst`. The key must be defined with a `Value` default.
+// Returns an error when the value could not be parsed.
+func (c *Conf) GetValue(key string, dst Value) error {
+	raw := c.read(key)
+	if raw == nil {
+		return errors.Errorf("key %s is not set", c.fullKey(key))
+	}
+	if def, ok := c.typedDefault(key); ok && copyValue(dst, def) {
+		return nil
+	}
+	if err := dst.Set(valueString(raw)); err != nil {
+		return errors.Wrapf(err, "invalid %s value for key %s", dst.Type(), c.fullKey(key))
+	}
+	return nil
+}
+
+// Returns the value of a key converted to the type of its default value. The key is not recorded as read.
+func (c *Conf) typedValue(k *key) (interface{}, error) {
+	if value, ok := c.typedDefault(k.name); ok {
+		return value, nil
+	}
+	raw, err := c.valueE(k.name)
+	if interpolationErr, ok := err.(*InterpolationError); ok {
+		return nil, errors.New(interpolationErr.reason())
+	}
+	if v, ok := k.value.(Value); ok {
+		dst := cloneValue(v)
+		if err := dst.Set(valueString(raw)); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s value", dst.Type())
+		}
+		return dst, nil
+	}
+	value, err := convert(raw, k.value)
+	if err != nil {
+		return nil, errors.Errorf("invalid %T value %q", k.value, valueString(raw))
+	}
+	return value, nil
+}
+
+// Returns the default of a declared key that no layer sets. Defaults are typed already, their flag strings may not
+// parse back: a zero time is "". String defaults are expanded like other values, see `Interpolate`.
+func (c *Conf) typedDefault(key string) (interface{}, bool) {
+	name, err := c.declaredName(key)
+	k, ok := c.keys[name]
+	if err != nil || !ok {
+		return nil, false
+	}
+	if _, isString := k.value.(string); isString || c.store.source(k).Layer != LayerDefault {
+		return nil, false
+	}
+	return k.value, true
+}
+
+// Returns the value converted to the type of `zero`, `zero` on errors.
+func (c *Conf) getE(key string, zero interface{}) (interface{}, error) {
+	raw, err := c.lookup(key)
+	if err != nil {
+		return zero, err
+	}
+	if value, ok := c.typedDefault(key); ok {
+		raw = value
+	}
+	value, err := convert(raw, zero)
+	if err != nil {
+		k := c.boundKey(key)
+		convErr := &ConversionError{Key: key, Value: valueString(raw), Type: fmt.Sprintf("%T", zero), Source: c.store.source(k), Err: err}
+		if c.store.isSensitive(k) {
+			convErr.Value = redacted
+		}
+		return zero, convErr
+	}
+	return value, nil
+}
+
 func (c *Conf) Set(key string, value interface{}) {
-	viper.GetViper().Set(c.fullKey(key), value)
+	c.store.set(c.fullKey(key), value)
 }
 
-// Low level constructor, useful for tests.
+// Low level constructor, useful for tests. The returned Conf has its own empty configuration store.
 func NewConf(appName, cmdName string) *Conf {
-	return &Conf{
-		appName: appName,
-		cmdName: cmdName,
-	}
+	return newConf(appName, cmdName, newConfigStore())
 }
 
-// Returns all values defined in this configuration instance
+// Returns all values defined in this configuration instance. Values of sensitive keys are redacted.
 func (c *Conf) AllValues() map[string]interface{} {
-	all := viper.GetViper().AllSettings()
-	if app, ok := all[c.appName].(map[string]interface{}); ok {
-		if c.cmdName == "" {
-			return app
-		} else {
-			if cmd, ok := app[c.cmdName].(map[string]interface{}); ok {
-				return cmd
-			} else {
-				return make(map[string]interface{})
-			}
+	all := c.store.allSettings()
+	section, ok := all[strings.ToLower(c.appName)].(map[string]interface{})
+	for _, cmd := range strings.Fields(c.cmdName) {
+		if !ok {
+			break
 		}
-	} else {
+		section, ok = section[strings.ToLower(cmd)].(map[string]interface{})
+	}
+	if !ok {
 		return make(map[string]interface{})
 	}
+	return section
 }
 
 func formatRootConfKey(appName, key string) string {
 	return strings.ToLower(fmt.Sprintf("%s.%s", appName, key))
 }
+
+// Subcommand names are separated by space: "db migrate"
 func formatCommandConfKey(appName, cmdName, key string) string {
-	return strings.ToLower(fmt.Sprintf("%s.%s.%s", appName, cmdName, key))
+	return strings.ToLower(fmt.Sprintf("%s.%s.%s", appName, strings.Replace(cmdName, " ", ".", -1), key))
 }
 func formatRootEnvKey(appName, key string) string {
 	return strings.ToUpper(fmt.Sprintf("%s_%s", appName, key))
 }
 func formatCommandEnvKey(appName, cmdName, key string) string {
-	return strings.ToUpper(fmt.Sprintf("%s_%s_%s", appName, cmdName, key))
+	return strings.ToUpper(fmt.Sprintf("%s_%s_%s", appName, strings.Replace(cmdName, " ", "_", -1), key))
 }
@@ -0,0 +1,256 @@
+package pungi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const configCmdName = "config"
+
+// Output formats of `config show`
+const (
+	FormatTOML = "toml"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Registers the `config` command with subcommands `show`, `get`, `explain`, `validate`, `init` and `encrypt-value`.
+// The commands use the keys defined on the builder and the commands, runnables are not called.
+func (p *pungiBuilder) ConfigCommand() *pungiBuilder {
+	p.configCommand = true
+	return p
+}
+
+func (p *pungiBuilder) initConfigCommand(pungi *Pungi) {
+	configCmd := &cobra.Command{
+		Use:   configCmdName,
+		Short: "Inspects the configuration.",
+	}
+
+	var format string
+	showCmd := &cobra.Command{
+		Use:   "show [command...]",
+		Short: "Prints the effective configuration.",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			confs, err := pungi.selectConfs(args)
+			if err != nil {
+				return err
+			}
+			return writeConfigValues(cobraCmd.OutOrStdout(), format, confs)
+		},
+	}
+	showCmd.Flags().StringVar(&format, "format", FormatTOML, "Output format: toml, json or yaml")
+
+	getCmd := &cobra.Command{
+		Use:   "get [command...] <key>",
+		Short: "Prints the value of one key.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			// Without a command name the key is read from the app section
+			conf := pungi.RootConfig()
+			if len(args) > 1 {
+				confs, err := pungi.selectConfs(args[:len(args)-1])
+				if err != nil {
+					return err
+				}
+				conf = confs[0]
+			}
+			name := args[len(args)-1]
+			k, ok := conf.keys[name]
+			switch {
+			case !ok && conf.cmdName == "":
+				return errors.Errorf("Unknown app key: %s, give the command name for command keys", name)
+			case !ok:
+				return errors.Errorf("Unknown key: %s", name)
+			}
+			value, err := conf.typedValue(k.key)
+			if err != nil {
+				return err
+			}
+			if conf.store.isSensitive(k) {
+				value = redacted
+			}
+			_, err = fmt.Fprintln(cobraCmd.OutOrStdout(), valueString(value))
+			return err
+		},
+	}
+
+	explainCmd := &cobra.Command{
+		Use:   "explain [command...]",
+		Short: "Prints every key with its value and source.",
+		Args:  cobra.ArbitraryArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			confs, err := pungi.selectConfs(args)
+			if err != nil {
+				return err
+			}
+			for _, conf := range confs {
+				_, _ = fmt.Fprintf(cobraCmd.OutOrStdout(), "[%s]\n%s\n", confSection(conf), conf.Explain())
+			}
+			return nil
+		},
+	}
+
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Loads the configuration and checks the validation rules of every command.",
+		Args:  cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			if _, err := pungi.selectConfs(nil); err != nil {
+				return err
+			}
+			if err := pungi.validate(); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintln(cobraCmd.OutOrStdout(), "Configuration is valid")
+			return err
+		},
+	}
+
+	var initFormat string
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Prints a config file with the default value and description of every key.",
+		Args:  cobra.NoArgs,
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return pungi.WriteDefaultConfig(cobraCmd.OutOrStdout(), initFormat)
+		},
+	}
+	initCmd.Flags().StringVar(&initFormat, "format", FormatTOML, "Output format: toml, json or yaml")
+
+	encryptCmd := &cobra.Command{
+		Use:   "encrypt-value <name> [value]",
+		Short: "Prints an entry of the encrypted secrets file. The value is read from stdin when not given.",
+		Args:  cobra.RangeArgs(1, 2),
+		// The config files may reference the secret that is being created, so they are not loaded
+		PersistentPreRunE: func(cobraCmd *cobra.Command, args []string) error {
+			return p.initRootFlags(pungi, cobraCmd)
+		},
+		RunE: func(cobraCmd *cobra.Command, args []string) error {
+			return encryptValue(p.secrets, pungi.stdin(), cobraCmd.OutOrStdout(), args)
+		},
+	}
+
+	configCmd.AddCommand(showCmd, getCmd, explainCmd, validateCmd, initCmd, encryptCmd)
+	// Cobra rejects the arguments of a command with subcommands unless they are validated
+	if p.runnable != nil && p.rootCommand.Args == nil {
+		p.rootCommand.Args = cobra.ArbitraryArgs
+	}
+	p.rootCommand.AddCommand(configCmd)
+}
+
+// Without a command name returns the root config (if it has keys) and all command configs.
+// Subcommands are given as separate arguments: `db migrate`.
+func (p *Pungi) selectConfs(args []string) ([]*Conf, error) {
+	if len(args) > 0 {
+		cmdName := strings.Join(args, " ")
+		conf, ok := p.confs[cmdName]
+		if !ok || cmdName == rootKey {
+			return nil, errors.Errorf("Unknown command: %s", cmdName)
+		}
+		return []*Conf{conf}, nil
+	}
+	var confs []*Conf
+	if root := p.RootConfig(); len(root.keys) > 0 {
+		confs = append(confs, root)
+	}
+	names := make([]string, 0, len(p.confs))
+	for name := range p.confs {
+		if name != rootKey {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		confs = append(confs, p.confs[name])
+	}
+	if len(confs) == 0 {
+		return nil, errors.New("No keys defined")
+	}
+	return confs, nil
+}
+
+func confSection(conf *Conf) string {
+	return strings.Join(confPath(conf), ".")
+}
+
+// Config file section of the command as path: `[app, db, migrate]`
+func confPath(conf *Conf) []string {
+	return strings.Fields(strings.ToLower(conf.appName + " " + conf.cmdName))
+}
+
+// Returns the nested map at the path, missing maps are created.
+func sectionMap(m map[string]interface{}, path []string) map[string]interface{} {
+	for _, part := range path {
+		sub, ok := m[part].(map[string]interface{})
+		if !ok {
+			sub = make(map[string]interface{})
+			m[part] = sub
+		}
+		m = sub
+	}
+	return m
+}
+
+// Writes the values in the same sections as the config file: `[app]` and `[app.cmd]`.
+func writeConfigValues(w io.Writer, format string, confs []*Conf) error {
+	values := make(map[string]interface{})
+	for _, conf := range confs {
+		section := sectionMap(values, confPath(conf))
+		for _, name := range conf.keyNames() {
+			value, err := conf.typedValue(conf.keys[name].key)
+			if err != nil {
+				return err
+			}
+			section[name] = displayValue(value)
+			if conf.store.isSensitive(conf.keys[name]) {
+				section[name] = redacted
+			}
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case FormatTOML:
+		tree, err := toml.TreeFromMap(values)
+		if err != nil {
+			return err
+		}
+		_, err = tree.WriteTo(w)
+		return err
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(values)
+	case FormatYAML:
+		out, err := yaml.Marshal(values)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	default:
+		return errors.Errorf("Unknown format: %s", format)
+	}
+}
+
+// Durations and custom values are written in the same form as they are parsed.
+func displayValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String()
+	case Value:
+		return v.String()
+	default:
+		return v
+	}
+}
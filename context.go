@@ -0,0 +1,125 @@
+package pungi
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Name of the key holding the shutdown grace period of context aware runnables.
+const shutdownTimeoutKey = "shutdownTimeout"
+
+const defaultShutdownTimeout = 10 * time.Second
+
+// RunnableContext is a runnable that stops when the context is cancelled.
+// The context is cancelled when the process receives SIGINT or SIGTERM.
+type RunnableContext = func(ctx context.Context, conf *Conf, args []string) error
+
+// Defines a context aware runnable function. See `RunContext` for details.
+func CmdContext(usageText, desc string, runnable RunnableContext) *Command {
+	c := Cmd(usageText, desc, nil)
+	c.runnable = runnable
+	c.handleSignals = true
+	return c
+}
+
+// Defines a context aware runnable function. When it's defined, no subcommands may be defined.
+//
+// On SIGINT or SIGTERM the context is cancelled and the runnable has `shutdownTimeout` (key, 10s by default)
+// to return. The process exits when the grace period is over or when a second signal is received.
+func (p *pungiBuilder) RunContext(runnable RunnableContext) *pungiBuilder {
+	p.runnable = runnable
+	p.handleSignals = true
+	return p
+}
+
+// Sets the default value of the `shutdownTimeout` key.
+func (p *pungiBuilder) ShutdownTimeout(timeout time.Duration) *pungiBuilder {
+	p.shutdownTimeout = timeout
+	return p
+}
+
+func withoutContext(runnable Runnable) RunnableContext {
+	if runnable == nil {
+		return nil
+	}
+	return func(_ context.Context, conf *Conf, args []string) error {
+		return runnable(conf, args)
+	}
+}
+
+// Adds the shutdown key for context aware runnables, unless the key is already defined.
+func (p *pungiBuilder) withShutdownKey(keys map[string]*key, handleSignals bool) map[string]*key {
+	if _, ok := keys[shutdownTimeoutKey]; !handleSignals || ok {
+		return keys
+	}
+	return merge(keys, map[string]*key{
+		shutdownTimeoutKey: newKey(shutdownTimeoutKey, p.shutdownTimeout, "Time to wait for a graceful shutdown after SIGINT or SIGTERM.", nil),
+	})
+}
+
+// Calls the runnable with a context that is cancelled with the context given to `ExecuteContext`.
+// With `handleSignals` the context is also cancelled on SIGINT or SIGTERM.
+func (p *Pungi) run(runnable RunnableContext, handleSignals bool, conf *Conf, args []string) error {
+	ctx, cancel := context.WithCancel(p.executeContext())
+	defer cancel()
+	if p.reportUnread {
+		defer p.reportUnreadKeys(conf)
+	}
+	if !handleSignals {
+		return runnable(ctx, conf, args)
+	}
+
+	// Read before a signal arrives, so the key is not reported as unread
+	timeout := conf.GetDuration(shutdownTimeoutKey)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		cancel()
+		grace := time.NewTimer(timeout)
+		defer grace.Stop()
+		select {
+		case <-signals:
+			p.logf(VerbosityInfo, "Received second signal, exiting")
+		case <-grace.C:
+			p.logf(VerbosityInfo, "Graceful shutdown timed out, exiting")
+		case <-done:
+			return
+		}
+		os.Exit(ExitFailure)
+	}()
+	return runnable(ctx, conf, args)
+}
+
+func (p *Pungi) executeContext() context.Context {
+	p.ctxMu.Lock()
+	defer p.ctxMu.Unlock()
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// Executes like `Execute`. Context aware runnables get a context that is cancelled together with `ctx`.
+func (p *Pungi) ExecuteContext(ctx context.Context, args ...string) error {
+	p.ctxMu.Lock()
+	p.ctx = ctx
+	p.ctxMu.Unlock()
+	defer func() {
+		p.ctxMu.Lock()
+		p.ctx = nil
+		p.ctxMu.Unlock()
+	}()
+	return p.Execute(args...)
+}
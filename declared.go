@@ -0,0 +1,118 @@
+package pungi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UndeclaredKeyError is returned by the `E` getters when the key is not declared on the builder or the command.
+type UndeclaredKeyError struct {
+	Key string
+	// Space separated command names, empty for the root command
+	Command string
+	// Declared key closest to the name, empty if none is close enough
+	Suggestion string
+}
+
+func (e *UndeclaredKeyError) Error() string {
+	msg := fmt.Sprintf("Key %s is not declared", e.Key)
+	if e.Command != "" {
+		msg += " for command " + e.Command
+	}
+	if e.Suggestion != "" {
+		msg += ", did you mean " + e.Suggestion + "?"
+	}
+	return msg
+}
+
+// Getters panic with `*UndeclaredKeyError` when the key is not declared on the builder or the command.
+// Meant for tests: a misspelled key fails loudly instead of reading the zero value.
+func (p *pungiBuilder) PanicOnUndeclaredKeys() *pungiBuilder {
+	p.panicOnUndeclared = true
+	return p
+}
+
+// Logs the declared keys that the runnable did not read, to find dead configuration. See `Conf.UnreadKeys`.
+func (p *pungiBuilder) ReportUnreadKeys() *pungiBuilder {
+	p.reportUnread = true
+	return p
+}
+
+// Returns the raw value for the `E` getters and records the key as read.
+func (c *Conf) lookup(key string) (interface{}, error) {
+	name, err := c.declaredName(key)
+	if err != nil {
+		return nil, err
+	}
+	c.readMu.Lock()
+	c.reads[name] = true
+	c.readMu.Unlock()
+	return c.valueE(key)
+}
+
+// Returns the raw value for the getters. Undeclared keys are read too unless `PanicOnUndeclaredKeys` is set.
+func (c *Conf) read(key string) interface{} {
+	value, err := c.lookup(key)
+	if _, undeclared := err.(*UndeclaredKeyError); undeclared && c.store.panicOnUndeclared {
+		panic(err)
+	}
+	if err != nil {
+		return c.value(key)
+	}
+	return value
+}
+
+// Returns the raw value without checking or recording the key. References that can't be expanded are kept.
+func (c *Conf) value(key string) interface{} {
+	value, err := c.valueE(key)
+	if err != nil {
+		return c.store.get(c.fullKey(key))
+	}
+	return value
+}
+
+func (c *Conf) valueE(key string) (interface{}, error) {
+	return c.store.getExpanded(c.fullKey(key))
+}
+
+// Keys are case insensitive like the config files. Without a builder every key is declared.
+func (c *Conf) declaredName(key string) (string, error) {
+	if !c.store.keysDeclared {
+		return key, nil
+	}
+	if _, ok := c.keys[key]; ok {
+		return key, nil
+	}
+	for name := range c.keys {
+		if strings.EqualFold(name, key) {
+			return name, nil
+		}
+	}
+	return "", &UndeclaredKeyError{Key: key, Command: c.cmdName, Suggestion: suggest(key, c.keyNames())}
+}
+
+// Returns the declared keys that were not read with the getters, `GetValue` or `Bind` since `Execute` started.
+// Sorted by name.
+func (c *Conf) UnreadKeys() []string {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	var unread []string
+	for _, name := range c.keyNames() {
+		if !c.reads[name] {
+			unread = append(unread, name)
+		}
+	}
+	return unread
+}
+
+func (c *Conf) resetReads() {
+	c.readMu.Lock()
+	c.reads = make(map[string]bool)
+	c.readMu.Unlock()
+}
+
+func (p *Pungi) reportUnreadKeys(conf *Conf) {
+	if unread := conf.UnreadKeys(); len(unread) > 0 {
+		p.logf(VerbosityInfo, "Config keys never read in [%s]: %s", confSection(conf), strings.Join(unread, ", "))
+	}
+}
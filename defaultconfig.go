@@ -0,0 +1,185 @@
+package pungi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Writes a config file containing every key with its default value. Descriptions are written as comments
+// (except for json). Sensitive keys are commented out with an empty value, required keys with their default,
+// json leaves them out. Each key is written to the section of the command that declared it: root keys to `[app]`,
+// command keys to `[app.cmd]`. Subcommands inherit the values of the parent sections.
+//
+// The values in the file override the defaults: a later change of a default doesn't apply while the file sets the key.
+//
+// format - toml, json or yaml
+func (p *Pungi) WriteDefaultConfig(w io.Writer, format string) error {
+	sections := p.declaredKeys()
+	if len(sections) == 0 {
+		return errors.New("No keys defined")
+	}
+	switch strings.ToLower(format) {
+	case FormatTOML:
+		return writeDefaultTOML(w, sections)
+	case FormatJSON:
+		return writeDefaultJSON(w, sections)
+	case FormatYAML:
+		return writeDefaultYAML(w, sections)
+	default:
+		return errors.Errorf("Unknown format: %s", format)
+	}
+}
+
+// keySection holds the keys declared by one command
+type keySection struct {
+	// Config file path, e.g. `[app, db, migrate]`
+	path []string
+	keys []*boundKey
+}
+
+// Returns the keys grouped by the command that declared them, parents before children.
+// Keys inherited from the builder are in the app section.
+func (p *Pungi) declaredKeys() []*keySection {
+	byCmd := make(map[string]*keySection)
+	add := func(cmdName string, k *boundKey) {
+		section, ok := byCmd[cmdName]
+		if !ok {
+			section = &keySection{path: confPath(&Conf{appName: p.appName, cmdName: cmdName})}
+			byCmd[cmdName] = section
+		}
+		for _, existing := range section.keys {
+			if existing.name == k.name {
+				return
+			}
+		}
+		section.keys = append(section.keys, k)
+	}
+	for cmdName, conf := range p.confs {
+		if cmdName == rootKey {
+			cmdName = ""
+		}
+		for _, name := range conf.keyNames() {
+			k := conf.keys[name]
+			if k.declared {
+				add(cmdName, k)
+			} else if !p.declaredByParent(cmdName, name) {
+				add("", k)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(byCmd))
+	for name := range byCmd {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sections := make([]*keySection, len(names))
+	for i, name := range names {
+		sections[i] = byCmd[name]
+		sort.Slice(sections[i].keys, func(a, b int) bool {
+			return sections[i].keys[a].name < sections[i].keys[b].name
+		})
+	}
+	return sections
+}
+
+func (p *Pungi) declaredByParent(cmdName, key string) bool {
+	path := strings.Fields(cmdName)
+	for i := len(path) - 1; i > 0; i-- {
+		if k, ok := p.confs[strings.Join(path[:i], " ")].keys[key]; ok && k.declared {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys written as a commented out placeholder, so the file doesn't set them
+func placeholder(k *boundKey) bool {
+	return k.sensitive || k.required
+}
+
+// Defaults of sensitive keys are not written
+func defaultValue(k *boundKey) interface{} {
+	if k.sensitive {
+		return ""
+	}
+	return displayValue(k.value)
+}
+
+func writeDefaultTOML(w io.Writer, sections []*keySection) error {
+	tree, err := toml.TreeFromMap(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	for _, section := range sections {
+		for _, k := range section.keys {
+			// TreeFromMap converts Go values to TOML values
+			converted, err := toml.TreeFromMap(map[string]interface{}{k.name: defaultValue(k)})
+			if err != nil {
+				return errors.Wrapf(err, "key %s", k.confKey)
+			}
+			tree.SetPathWithComment(append(section.path, k.name), k.desc, placeholder(k), converted.Get(k.name))
+		}
+	}
+	_, err = tree.WriteTo(w)
+	return err
+}
+
+func writeDefaultJSON(w io.Writer, sections []*keySection) error {
+	values := make(map[string]interface{})
+	for _, section := range sections {
+		m := sectionMap(values, section.path)
+		for _, k := range section.keys {
+			if !placeholder(k) {
+				m[k.name] = defaultValue(k)
+			}
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(values)
+}
+
+// yaml.v2 does not write comments, the sections are written by hand.
+// Sections are sorted, so the keys of a command come before its subcommands.
+func writeDefaultYAML(w io.Writer, sections []*keySection) error {
+	var buf bytes.Buffer
+	var written []string
+	for _, section := range sections {
+		for i, part := range section.path {
+			if i < len(written) && written[i] == part {
+				continue
+			}
+			buf.WriteString(strings.Repeat("  ", i) + part + ":\n")
+			written = append(written[:i], part)
+		}
+		indent := strings.Repeat("  ", len(section.path))
+		for _, k := range section.keys {
+			out, err := yaml.Marshal(map[string]interface{}{k.name: defaultValue(k)})
+			if err != nil {
+				return errors.Wrapf(err, "key %s", k.confKey)
+			}
+			if k.desc != "" {
+				_, _ = fmt.Fprintf(&buf, "%s# %s\n", indent, k.desc)
+			}
+			prefix := indent
+			if placeholder(k) {
+				prefix += "# "
+			}
+			for _, line := range strings.SplitAfter(strings.TrimSuffix(string(out), "\n"), "\n") {
+				buf.WriteString(prefix + line)
+			}
+			buf.WriteString("\n")
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
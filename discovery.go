@@ -0,0 +1,158 @@
+package pungi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Name of the drop-in directory next to a config file
+const confDirName = "conf.d"
+
+// configFlag collects the repeatable `--config` flag. Unlike pflag's string array it can be reset
+// before every execution.
+type configFlag struct {
+	paths []string
+}
+
+func (f *configFlag) Set(value string) error {
+	if value != "" {
+		f.paths = append(f.paths, value)
+	}
+	return nil
+}
+
+func (f *configFlag) Type() string {
+	return "stringArray"
+}
+
+func (f *configFlag) String() string {
+	return strings.Join(f.paths, ",")
+}
+
+// Sets the config files that are read when the config file is not given with `--config` or `APP_CONFIG`.
+// Missing files are skipped, the found files are merged in order: later files override earlier ones.
+// Environment variables in the paths are expanded, e.g. `$HOME/.myapp.toml`.
+//
+// By default: `/etc/<app>/config.toml`, `$XDG_CONFIG_HOME/<app>/config.toml` (`~/.config` if not set)
+// and the default config file, see `DefaultConfigFile`.
+func (p *pungiBuilder) ConfigSearchPath(paths ...string) *pungiBuilder {
+	p.searchPath = paths
+	return p
+}
+
+func (p *pungiBuilder) configSearchPath() []string {
+	if p.searchPath != nil {
+		paths := make([]string, len(p.searchPath))
+		for i, path := range p.searchPath {
+			paths[i] = os.ExpandEnv(path)
+		}
+		return paths
+	}
+	appDir := strings.ToLower(p.appName)
+	paths := []string{filepath.Join("/etc", appDir, "config.toml")}
+	if configHome := userConfigHome(); configHome != "" {
+		paths = append(paths, filepath.Join(configHome, appDir, "config.toml"))
+	}
+	return append(paths, p.defaultConfigFile)
+}
+
+func userConfigHome() string {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return configHome
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config")
+	}
+	return ""
+}
+
+// Reads the config files given by the user or the files found from the search path.
+// The profile files are added after their base file and the drop-in files after the files of their directory.
+func (p *pungiBuilder) findConfigFiles(pungi *Pungi, cfgFiles []string) (configFiles, error) {
+	var files configFiles
+	for _, path := range cfgFiles {
+		file, err := readConfigFile(path, pungi.configFormat)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not load config from %s", path)
+		}
+		files = append(files, file)
+	}
+	if len(cfgFiles) == 0 {
+		searched, err := p.searchConfigFiles(pungi)
+		if err != nil {
+			return nil, err
+		}
+		files = searched
+	}
+	files, err := withProfileFiles(files, pungi.profile)
+	if err != nil {
+		return nil, err
+	}
+	if files, err = withDropIns(files); err != nil {
+		return nil, err
+	}
+	return files, resolveSecrets(files, p.secrets)
+}
+
+func (p *pungiBuilder) searchConfigFiles(pungi *Pungi) (configFiles, error) {
+	var files configFiles
+	for _, path := range p.configSearchPath() {
+		file, err := readConfigFile(path, "")
+		if os.IsNotExist(err) {
+			pungi.logf(VerbosityDebug, "Config file not found: %s", path)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not load config from %s", path)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// Adds the `conf.d/*.toml` files in lexical order after the last config file of their parent directory.
+func withDropIns(files configFiles) (configFiles, error) {
+	var out configFiles
+	for i, file := range files {
+		out = append(out, file)
+		dir := filepath.Dir(file.name)
+		if inDir(files[i+1:], dir) {
+			continue
+		}
+		// Glob sorts the matches
+		paths, err := filepath.Glob(filepath.Join(dir, confDirName, "*.toml"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			dropIn, err := readConfigFile(path, "")
+			if err != nil {
+				return nil, errors.Wrapf(err, "Could not load config from %s", path)
+			}
+			out = append(out, dropIn)
+		}
+	}
+	return out, nil
+}
+
+func inDir(files configFiles, dir string) bool {
+	for _, file := range files {
+		if filepath.Dir(file.name) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func splitPathList(list string) []string {
+	var paths []string
+	for _, path := range filepath.SplitList(list) {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
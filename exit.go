@@ -0,0 +1,95 @@
+package pungi
+
+// Exit codes of `Execute` and `ExecuteE`
+const (
+	ExitOK = 0
+	// The runnable returned an error
+	ExitFailure = 1
+	// Unknown command or flag, invalid arguments
+	ExitUsage = 2
+	// The config file could not be loaded or a key is invalid
+	ExitConfig = 3
+)
+
+// ExitError is an error with an exit code. Runnables return it to exit with a specific code:
+//
+//	return pungi.WithExitCode(errors.New("Port is in use"), 4)
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Cause() error {
+	return e.Err
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the error with the exit code. Returns nil if err is nil.
+func WithExitCode(err error, code int) error {
+	if err == nil {
+		return nil
+	}
+	return &ExitError{Code: code, Err: err}
+}
+
+// Returns the error with exit code `ExitUsage`.
+func UsageError(err error) error {
+	return WithExitCode(err, ExitUsage)
+}
+
+// Returns the error with exit code `ExitConfig`.
+func ConfigError(err error) error {
+	return WithExitCode(err, ExitConfig)
+}
+
+// Returns the exit code for the error returned by `Pungi.Execute`.
+// The code of the first `ExitError` in the cause chain is used, `*ValidationError` and `*UnknownKeysError` are `ExitConfig`
+// and all other errors are `ExitFailure`.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if code, ok := exitCode(err); ok {
+		return code
+	}
+	return ExitFailure
+}
+
+func exitCode(err error) (int, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *ExitError:
+			return e.Code, true
+		case *ValidationError, *UnknownKeysError:
+			return ExitConfig, true
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// Initializes and executes Pungi. Returns the exit code instead of exiting, useful for tests.
+// Errors are printed to the error writer, see `Output`.
+//
+// args - arguments for executable. By default: `os.Args[1:]`
+func (p *pungiBuilder) ExecuteE(args ...string) int {
+	pungi, err := p.Initialize()
+	if err != nil {
+		(&Pungi{errOut: p.errOut}).printError(nil, err)
+		return ExitCode(err)
+	}
+	// Execution errors are printed by Execute
+	return ExitCode(pungi.Execute(args...))
+}
@@ -0,0 +1,140 @@
+package pungi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Name of the flag overriding the format of the config files given with `--config`
+const configFormatFlag = "config-format"
+
+// Format of .env files. Their `APP_CMD_KEY=value` lines are used like env variables.
+const FormatEnv = "env"
+
+// Config file formats: toml, yaml, yml, json, hcl, properties, props, prop and env
+var configFormats = append(append([]string(nil), viper.SupportedExts...), FormatEnv)
+
+func (p *pungiBuilder) initConfigFormatFlag(pungi *Pungi) {
+	p.rootCommand.PersistentFlags().StringVar(&pungi.configFormat, configFormatFlag, "",
+		"format of the config files without an extension: "+strings.Join(configFormats, ", "))
+}
+
+// The flag overrides the env variable
+func (p *Pungi) initConfigFormat(cobraCmd *cobra.Command) {
+	if !cobraCmd.Flags().Changed(configFormatFlag) {
+		p.configFormat = os.Getenv(formatRootEnvKey(p.appName, "CONFIG_FORMAT"))
+	}
+}
+
+// format - format of a file without an extension, may be empty. The extension wins otherwise.
+func readConfigFile(filePath, format string) (*configFile, error) {
+	if ext := filepath.Ext(filePath); ext != "" {
+		format = strings.TrimPrefix(ext, ".")
+	}
+	format = strings.ToLower(format)
+	if !stringInSlice(format, configFormats) {
+		return nil, viper.UnsupportedConfigError(format)
+	}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	file := &configFile{name: filePath, format: format, content: content, values: viper.New()}
+	if err := readValues(file); err != nil {
+		return nil, err
+	}
+	return file, resolveFileRefs(file)
+}
+
+func readValues(file *configFile) (err error) {
+	switch file.format {
+	case FormatEnv:
+		file.env, file.envLines, err = parseDotEnv(file.content)
+		return err
+	case "hcl":
+		// Blocks are decoded as lists of maps, sections must be maps
+		hclValues := viper.New()
+		hclValues.SetConfigType(file.format)
+		if err := hclValues.ReadConfig(bytes.NewReader(file.content)); err != nil {
+			return err
+		}
+		return file.values.MergeConfigMap(hclBlocksToMaps(hclValues.AllSettings()).(map[string]interface{}))
+	}
+	file.values.SetConfigType(file.format)
+	if err := file.values.ReadConfig(bytes.NewReader(file.content)); err != nil {
+		return err
+	}
+	if file.format == "toml" {
+		// Positions are optional, the values are already parsed.
+		file.tree, _ = toml.LoadBytes(file.content)
+	}
+	return nil
+}
+
+func hclBlocksToMaps(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		merged := make(map[string]interface{})
+		for _, block := range v {
+			for key, blockValue := range block {
+				merged[key] = hclBlocksToMaps(blockValue)
+			}
+		}
+		return merged
+	case map[string]interface{}:
+		for key, mapValue := range v {
+			v[key] = hclBlocksToMaps(mapValue)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Parses `KEY=value` lines. Empty lines, `#` comments and the `export` prefix are skipped,
+// values may be quoted.
+func parseDotEnv(content []byte) (map[string]string, map[string]int, error) {
+	values := make(map[string]string)
+	lines := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(kv) != 2 {
+			return nil, nil, fmt.Errorf("line %d: expected KEY=value", lineNo)
+		}
+		name := strings.ToUpper(strings.TrimSpace(kv[0]))
+		values[name] = unquote(strings.TrimSpace(kv[1]))
+		lines[name] = lineNo
+	}
+	return values, lines, scanner.Err()
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Returns the last .env file that sets the env variable of the key, nil if none does.
+func (files configFiles) findEnv(k *boundKey) *configFile {
+	for i := len(files) - 1; i >= 0; i-- {
+		if _, ok := files[i].env[k.envKey]; ok {
+			return files[i]
+		}
+	}
+	return nil
+}
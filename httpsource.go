@@ -0,0 +1,215 @@
+package pungi
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Name of the flag setting the URL of the `ConfigURL` source
+const configURLFlag = "config-url"
+
+const defaultPollInterval = 30 * time.Second
+
+// Largest JSON config accepted from the URL, a larger response fails the load
+const maxHTTPConfigSize = 1 << 20
+
+// HTTPSource loads JSON config from an HTTP(S) URL. With `WatchConfig` the URL is polled,
+// the ETag of the last response avoids downloading unchanged config.
+type HTTPSource struct {
+	url string
+	// URL given to `NewHTTPSource`, restored before each run
+	defaultURL   string
+	cacheFile    string
+	pollInterval time.Duration
+	client       *http.Client
+
+	mu     sync.Mutex
+	etag   string
+	values map[string]interface{}
+	// Last failure to write the cache, returned by `Load` as a warning
+	cacheErr error
+}
+
+// Cached response, the last known good config
+type httpCache struct {
+	ETag   string                 `json:"etag"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// url - may be empty when it's given with `--config-url`, see `ConfigURL`
+func NewHTTPSource(url string) *HTTPSource {
+	return &HTTPSource{
+		url:          url,
+		pollInterval: defaultPollInterval,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Writes the last response to the file. When the URL can't be loaded on startup, the cached config is used.
+func (s *HTTPSource) Cache(path string) *HTTPSource {
+	s.cacheFile = path
+	return s
+}
+
+// Sets how often the URL is polled with `WatchConfig`, 30s by default.
+func (s *HTTPSource) PollInterval(interval time.Duration) *HTTPSource {
+	s.pollInterval = interval
+	return s
+}
+
+// Sets the client used for the requests, e.g. for TLS settings.
+func (s *HTTPSource) Client(client *http.Client) *HTTPSource {
+	s.client = client
+	return s
+}
+
+func (s *HTTPSource) Name() string {
+	return s.url
+}
+
+// Returns the cached config with the error when the URL can't be loaded, and the config with the error when
+// the cache can't be written.
+func (s *HTTPSource) Load() (map[string]interface{}, error) {
+	_, err := s.fetch()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil && s.values == nil && s.cacheFile != "" {
+		if cached, cacheErr := readHTTPCache(s.cacheFile); cacheErr == nil {
+			s.etag, s.values = cached.ETag, cached.Values
+		}
+	}
+	if err == nil {
+		err = s.cacheErr
+	}
+	return s.values, err
+}
+
+// Returns true if the config changed.
+func (s *HTTPSource) fetch() (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	s.mu.Unlock()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return false, nil
+	case resp.StatusCode != http.StatusOK:
+		return false, errors.Errorf("%s returned %s", s.url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPConfigSize+1))
+	if err != nil {
+		return false, err
+	}
+	if len(body) > maxHTTPConfigSize {
+		return false, errors.Errorf("%s returned more than %d bytes", s.url, maxHTTPConfigSize)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(body, &values); err != nil {
+		return false, errors.Wrapf(err, "Invalid JSON from %s", s.url)
+	}
+	etag := resp.Header.Get("ETag")
+	var cacheErr error
+	if s.cacheFile != "" {
+		if err := writeHTTPCache(s.cacheFile, httpCache{ETag: etag, Values: values}); err != nil {
+			cacheErr = errors.Wrapf(err, "Could not write cache %s", s.cacheFile)
+		}
+	}
+	s.mu.Lock()
+	s.etag, s.values, s.cacheErr = etag, values, cacheErr
+	s.mu.Unlock()
+	return true, nil
+}
+
+// Polls the URL, see `SourceWatcher`.
+func (s *HTTPSource) Watch(done <-chan struct{}, changed func(err error)) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if ok, err := s.fetch(); ok || err != nil {
+				changed(err)
+			}
+		}
+	}
+}
+
+func readHTTPCache(path string) (httpCache, error) {
+	var cached httpCache
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cached, err
+	}
+	err = json.Unmarshal(content, &cached)
+	return cached, err
+}
+
+func writeHTTPCache(path string, cached httpCache) error {
+	content, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0600)
+}
+
+// Adds the source with the `--config-url` flag (or `APP_CONFIG_URL`) overriding its URL. See `ConfigSource`.
+// Without a URL the source is disabled.
+func (p *pungiBuilder) ConfigURL(source *HTTPSource, above Layer) *pungiBuilder {
+	p.configURL = source
+	p.ConfigSource(source, above)
+	p.sources[len(p.sources)-1].enabled = func() bool {
+		return source.url != ""
+	}
+	return p
+}
+
+func (p *pungiBuilder) initConfigURLFlag(pungi *Pungi) {
+	if p.configURL != nil {
+		pungi.configURL = p.configURL
+		p.configURL.defaultURL = p.configURL.url
+		p.rootCommand.PersistentFlags().StringVar(&p.configURL.url, configURLFlag, p.configURL.url, "URL of the JSON config")
+	}
+}
+
+// Cobra keeps the flag value between runs
+func (p *Pungi) resetConfigURL() {
+	if p.configURL == nil {
+		return
+	}
+	p.configURL.url = p.configURL.defaultURL
+	p.rootCmd.PersistentFlags().Lookup(configURLFlag).Changed = false
+}
+
+// The flag overrides the env variable
+func (p *pungiBuilder) initConfigURL(cobraCmd *cobra.Command) {
+	if p.configURL == nil || cobraCmd.Flags().Changed(configURLFlag) {
+		return
+	}
+	if url := os.Getenv(formatRootEnvKey(p.appName, "CONFIG_URL")); url != "" {
+		p.configURL.url = url
+	}
+}
@@ -0,0 +1,115 @@
+package pungi
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// `${HOSTNAME}`, `${PORT:-8080}` or `${testapp.grpc.port}`
+var interpolation = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// Expands `${ENV_VAR}`, `${ENV_VAR:-default}` and `${app.cmd.key}` references in string values of any layer.
+// Names with a dot are config keys, other names are env variables. Unset env variables expand to the default
+// or to an empty string.
+func (p *pungiBuilder) Interpolate() *pungiBuilder {
+	p.interpolate = true
+	return p
+}
+
+// InterpolationError is returned when a reference can't be expanded.
+type InterpolationError struct {
+	// Key of the expanded value, e.g. `testapp.httpgw.grpcuri`
+	Key string
+	// Keys referencing each other, the first key is repeated at the end. Empty for unknown keys.
+	Cycle []string
+	// The reference that could not be resolved, e.g. `testapp.grpc.prot`
+	Ref string
+}
+
+func (e *InterpolationError) Error() string {
+	return fmt.Sprintf("Key %s: %s", e.Key, e.reason())
+}
+
+func (e *InterpolationError) reason() string {
+	if len(e.Cycle) > 0 {
+		return "interpolation cycle " + strings.Join(e.Cycle, " -> ")
+	}
+	return fmt.Sprintf("unknown key in ${%s}", e.Ref)
+}
+
+// Returns the value with the references expanded when interpolation is enabled.
+func (s *configStore) getExpanded(confKey string) (interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value := s.value(confKey)
+	if !s.interpolate {
+		return value, nil
+	}
+	return s.expand(value, []string{confKey})
+}
+
+// path - keys being expanded, the last one holds the value
+func (s *configStore) expand(value interface{}, path []string) (interface{}, error) {
+	str, ok := value.(string)
+	if !ok || !strings.Contains(str, "${") {
+		return value, nil
+	}
+	var expandErr error
+	expanded := interpolation.ReplaceAllStringFunc(str, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		def, hasDefault := "", false
+		if i := strings.Index(name, ":-"); i >= 0 {
+			name, def, hasDefault = name[:i], name[i+2:], true
+		}
+		if !strings.Contains(name, ".") {
+			if env := os.Getenv(name); env != "" || !hasDefault {
+				return env
+			}
+			return def
+		}
+		resolved, err := s.expandKey(strings.ToLower(name), path)
+		switch {
+		case err != nil && expandErr == nil:
+			expandErr = err
+		case resolved == nil && hasDefault:
+			return def
+		case resolved == nil && expandErr == nil:
+			expandErr = &InterpolationError{Key: path[0], Ref: name}
+		}
+		return valueString(resolved)
+	})
+	if expandErr != nil {
+		return nil, expandErr
+	}
+	return expanded, nil
+}
+
+func (s *configStore) expandKey(confKey string, path []string) (interface{}, error) {
+	for i, k := range path {
+		if k == confKey {
+			cycle := append(append([]string(nil), path[i:]...), confKey)
+			return nil, &InterpolationError{Key: path[0], Cycle: cycle}
+		}
+	}
+	value := s.value(confKey)
+	if value == nil {
+		value = s.inheritedDefault(confKey)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	return s.expand(value, append(append([]string(nil), path...), confKey))
+}
+
+// Keys inherited by commands are not bound to the parent sections: `${app.host}` is the default of the `host` key
+// unless the config files set it.
+func (s *configStore) inheritedDefault(fileKey string) interface{} {
+	for _, k := range s.keys {
+		if stringInSlice(fileKey, k.fileKeys) {
+			return k.value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package pungi
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// Name of the flag holding the verbosity of the diagnostics.
+const verbosityFlag = "verbosity"
+
+// Verbosity levels of the diagnostics
+const (
+	// No diagnostics, errors are still printed
+	VerbosityQuiet = 0
+	// Config file used, reloads and shutdown
+	VerbosityInfo = 1
+	// Details of the config file lookup
+	VerbosityDebug = 2
+)
+
+// Logger receives the diagnostics of Pungi, e.g. "Using config file: config.toml".
+// The standard library `*log.Logger` implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Sets the writers of the help, usage, error and `config` command output. Diagnostics are written
+// to `errOut` unless a logger is set. By default os.Stdout and os.Stderr.
+func (p *pungiBuilder) Output(out, errOut io.Writer) *pungiBuilder {
+	p.out = out
+	p.errOut = errOut
+	return p
+}
+
+// Sets the reader of the values given to `config encrypt-value` on stdin. By default os.Stdin.
+func (p *pungiBuilder) Input(in io.Reader) *pungiBuilder {
+	p.in = in
+	return p
+}
+
+// Sets the logger of the diagnostics.
+func (p *pungiBuilder) Logger(logger Logger) *pungiBuilder {
+	p.logger = logger
+	return p
+}
+
+// Sets the default verbosity of the diagnostics. The `verbosity` flag and the `APP_VERBOSITY`
+// env variable override it.
+func (p *pungiBuilder) Verbosity(level int) *pungiBuilder {
+	p.verbosity = level
+	return p
+}
+
+// Disables the diagnostics. Same as `Verbosity(VerbosityQuiet)`.
+func (p *pungiBuilder) Quiet() *pungiBuilder {
+	return p.Verbosity(VerbosityQuiet)
+}
+
+func (p *pungiBuilder) initOutput(pungi *Pungi) {
+	pungi.in = p.in
+	pungi.out = p.out
+	pungi.errOut = p.errOut
+	pungi.logger = p.logger
+	pungi.verbosity = p.verbosity
+	pungi.defaultVerbosity = p.verbosity
+	if p.out != nil {
+		p.rootCommand.SetOutput(p.out)
+	}
+	p.rootCommand.SilenceErrors = true
+	p.rootCommand.SilenceUsage = true
+	p.rootCommand.PersistentFlags().IntVar(&pungi.verbosity, verbosityFlag, p.verbosity,
+		"Verbosity of the diagnostics: 0 - quiet, 1 - info, 2 - debug")
+}
+
+// The flag overrides the env variable
+func (p *Pungi) initVerbosity(cobraCmd *cobra.Command) error {
+	if cobraCmd.Flags().Changed(verbosityFlag) {
+		return nil
+	}
+	p.verbosity = p.defaultVerbosity
+	envKey := formatRootEnvKey(p.appName, verbosityFlag)
+	if value := os.Getenv(envKey); value != "" {
+		level, err := strconv.Atoi(value)
+		if err != nil {
+			return ConfigError(fmt.Errorf("Invalid %s: %s", envKey, value))
+		}
+		p.verbosity = level
+	}
+	return nil
+}
+
+func (p *Pungi) logf(level int, format string, v ...interface{}) {
+	if level > p.verbosity {
+		return
+	}
+	if p.logger != nil {
+		p.logger.Printf(format, v...)
+		return
+	}
+	_, _ = fmt.Fprintf(p.stderr(), format+"\n", v...)
+}
+
+func (p *Pungi) stdin() io.Reader {
+	if p.in != nil {
+		return p.in
+	}
+	return os.Stdin
+}
+
+// Resolved on every call, so tests can replace os.Stdout
+func (p *Pungi) stdout() io.Writer {
+	if p.out != nil {
+		return p.out
+	}
+	return os.Stdout
+}
+
+func (p *Pungi) stderr() io.Writer {
+	if p.errOut != nil {
+		return p.errOut
+	}
+	return os.Stderr
+}
+
+// Prints the error and, for usage errors, the usage of the command.
+func (p *Pungi) printError(cmd *cobra.Command, err error) {
+	_, _ = fmt.Fprintln(p.stderr(), "Error:", err)
+	if ExitCode(err) == ExitUsage && cmd != nil {
+		_, _ = fmt.Fprint(p.stderr(), cmd.UsageString())
+	}
+}
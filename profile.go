@@ -0,0 +1,90 @@
+package pungi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Name of the flag selecting the profile
+const profileFlag = "profile"
+
+// Config file sections overlaying their parent section when the profile is active: `[app.profiles.prod]`
+const profilesSection = "profiles"
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func (p *pungiBuilder) initProfileFlag(pungi *Pungi) {
+	p.rootCommand.PersistentFlags().StringVar(&pungi.profile, profileFlag, "",
+		"Configuration profile, e.g. dev or prod")
+}
+
+// The flag overrides the env variable
+func (p *Pungi) initProfile(cobraCmd *cobra.Command) error {
+	if !cobraCmd.Flags().Changed(profileFlag) {
+		p.profile = os.Getenv(formatRootEnvKey(p.appName, profileFlag))
+	}
+	if p.profile != "" && !profileName.MatchString(p.profile) {
+		return ConfigError(fmt.Errorf("Invalid profile: %s", p.profile))
+	}
+	p.store.mu.Lock()
+	p.store.profile = p.profile
+	p.store.mu.Unlock()
+	return nil
+}
+
+// Returns the profile selected with `--profile` or `APP_PROFILE`, empty if none is.
+func (p *Pungi) ActiveProfile() string {
+	return p.store.activeProfile()
+}
+
+// Returns the profile selected with `--profile` or `APP_PROFILE`, empty if none is.
+func (c *Conf) ActiveProfile() string {
+	return c.store.activeProfile()
+}
+
+func (s *configStore) activeProfile() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.profile
+}
+
+// Adds the profile section path before each config file path: `app.db.profiles.prod.port` before `app.db.port`.
+func profileKeys(fileKeys []string, profile string) []string {
+	if profile == "" {
+		return fileKeys
+	}
+	out := make([]string, 0, 2*len(fileKeys))
+	for _, fileKey := range fileKeys {
+		i := strings.LastIndex(fileKey, ".")
+		out = append(out, fileKey[:i]+"."+profilesSection+"."+strings.ToLower(profile)+fileKey[i:], fileKey)
+	}
+	return out
+}
+
+// Adds the profile file after each config file: `config.prod.toml` after `config.toml`. Missing files are skipped.
+func withProfileFiles(files configFiles, profile string) (configFiles, error) {
+	if profile == "" {
+		return files, nil
+	}
+	var out configFiles
+	for _, file := range files {
+		out = append(out, file)
+		ext := filepath.Ext(file.name)
+		path := strings.TrimSuffix(file.name, ext) + "." + profile + ext
+		profileFile, err := readConfigFile(path, file.format)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Could not load config from %s", path)
+		}
+		out = append(out, profileFile)
+	}
+	return out, nil
+}
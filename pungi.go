@@ -1,19 +1,25 @@
 package pungi
 
 import (
+	"context"
 	goflag "flag"
-	"fmt"
+	"io"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
-	"github.com/spf13/viper"
 )
 
 const rootKey = "_root_"
 
+// Guards merging of the global go flags into pflag's command line, which is shared by all Pungi instances.
+var goFlagsOnce sync.Once
+
 /*
  Start here.
 
@@ -32,6 +38,8 @@ func New(usageText, desc string) *pungiBuilder {
 		usageText:         usageText,
 		desc:              desc,
 		defaultConfigFile: "config.toml",
+		shutdownTimeout:   defaultShutdownTimeout,
+		verbosity:         VerbosityInfo,
 		commands:          make(map[string]*Command),
 		keys:              make(map[string]*key),
 		confs:             make(map[string]*Conf),
@@ -40,28 +48,26 @@ func New(usageText, desc string) *pungiBuilder {
 
 // Initializes configuration only from a config file. Useful for using inside tests.
 func NewConfigFileOnly(appName, filePath string) (*Pungi, error) {
-	viper.SetConfigFile(filePath)
-	err := viper.ReadInConfig()
+	store := newConfigStore()
+	file, err := readConfigFile(filePath, "")
 	if err == nil {
-		println("Using config file: " + viper.ConfigFileUsed())
-		return &Pungi{
-			appName:        appName,
-			configFileUsed: viper.ConfigFileUsed(),
-		}, nil
-	} else {
-		_, _ = fmt.Fprintf(os.Stderr, "Could not load config from %s\n Error: %v", viper.ConfigFileUsed(), err)
-		return nil, err
+		err = store.useFiles(configFiles{file})
 	}
+	if err != nil {
+		return nil, ConfigError(errors.Wrapf(err, "Could not load config from %s", filePath))
+	}
+	return &Pungi{
+		appName:         appName,
+		configFileUsed:  filePath,
+		configFilesUsed: []string{filePath},
+		store:           store,
+	}, nil
 }
 
-// Initializes and executes Pungi. In case of errors panics.
+// Initializes and executes Pungi. In case of errors prints the error to stderr and exits with `ExitCode(err)`.
 func (p *pungiBuilder) Execute() {
-	if pungi, err := p.Initialize(); err != nil {
-		panic(err)
-	} else {
-		if err := pungi.Execute(); err != nil {
-			panic(err)
-		}
+	if code := p.ExecuteE(); code != ExitOK {
+		os.Exit(code)
 	}
 }
 
@@ -72,27 +78,50 @@ func (p *pungiBuilder) Initialize() (*Pungi, error) {
 		return nil, err
 	}
 
-	pungi := &Pungi{}
+	p.store = newConfigStore()
+	p.store.keysDeclared = true
+	p.store.panicOnUndeclared = p.panicOnUndeclared
+	p.store.interpolate = p.interpolate
+	p.store.sources = p.sources
+	p.store.order = p.precedence
+	pungi := &Pungi{store: p.store}
 	p.appName = firstWord(p.usageText)
 	p.initRootCommand(pungi)
+	p.initOutput(pungi)
+	p.initProfileFlag(pungi)
+	p.initConfigFormatFlag(pungi)
+	p.initConfigURLFlag(pungi)
 	if p.runnable != nil {
 		p.initRootKeys()
+	} else {
+		p.bindRootKeysWithoutFlags()
 	}
 
 	if len(p.commands) > 0 {
 		for _, cmd := range p.commands {
-			p.initSubCommand(cmd)
+			p.initSubCommand(pungi, p.rootCommand, "", p.keys, cmd)
 		}
 	}
+	if p.configCommand {
+		p.initConfigCommand(pungi)
+	}
 
 	pungi.appName = p.appName
 	pungi.confs = p.confs
+	pungi.watchConfig = p.watchConfig
+	pungi.unknownKeys = p.unknownKeys
+	pungi.reportUnread = p.reportUnread
+	pungi.secrets = p.secrets
 	pungi.rootCmd = p.rootCommand
 
-	// Adds "normal" flags too. I.e. glog
-	flag.CommandLine.AddGoFlagSet(goflag.CommandLine)
-	// Hack to convince flag that flags are parsed.
-	if err := flag.CommandLine.Parse([]string{}); err != nil {
+	var err error
+	goFlagsOnce.Do(func() {
+		// Adds "normal" flags too. I.e. glog
+		flag.CommandLine.AddGoFlagSet(goflag.CommandLine)
+		// Hack to convince flag that flags are parsed.
+		err = flag.CommandLine.Parse([]string{})
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -104,11 +133,20 @@ func (p *pungiBuilder) DefaultConfigFile(filename string) *pungiBuilder {
 	return p
 }
 
-func (p *pungiBuilder) Key(name string, value interface{}, desc string) *pungiBuilder {
-	p.keys[name] = &key{
-		name:  name,
-		value: value,
-		desc:  desc,
+// Defines a key shared by all commands. Options add validation rules, e.g. `pungi.Required()`.
+func (p *pungiBuilder) Key(name string, value interface{}, desc string, options ...KeyOption) *pungiBuilder {
+	p.keys[name] = newKey(name, value, desc, options)
+	return p
+}
+
+// Defines keys from the fields of a struct. See `Command.KeysFrom`.
+func (p *pungiBuilder) KeysFrom(defaults interface{}) *pungiBuilder {
+	keys, err := keysFrom(defaults)
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	for _, key := range keys {
+		p.keys[key.name] = key
 	}
 	return p
 }
@@ -121,7 +159,8 @@ func (p *pungiBuilder) Cmd(command *Command) *pungiBuilder {
 
 // Defines runnable function. When it's defined, no subcommands may be defined.
 func (p *pungiBuilder) Run(runnable func(conf *Conf, args []string) error) *pungiBuilder {
-	p.runnable = runnable
+	p.runnable = withoutContext(runnable)
+	p.handleSignals = false
 	return p
 }
 
@@ -143,9 +182,20 @@ func merge(a, b map[string]*key) (out map[string]*key) {
 }
 
 func (p *pungiBuilder) validateInput() error {
+	if p.err != nil {
+		return p.err
+	}
+	for _, cmd := range allCommands(p.commands) {
+		if cmd.err != nil {
+			return cmd.err
+		}
+	}
 	if err := p.validateKeys(); err != nil {
 		return err
 	}
+	if _, ok := p.commands[configCmdName]; ok && p.configCommand {
+		return errors.New("Command name \"config\" is reserved for the config command.")
+	}
 	if p.runnable != nil && len(p.commands) > 0 && p.args == nil {
 		return errors.New("If you define main and subcommands, then you need to define arguments for the main command.")
 	}
@@ -153,20 +203,48 @@ func (p *pungiBuilder) validateInput() error {
 }
 
 func (p *pungiBuilder) initRootKeys() {
-	for _, key := range p.keys {
+	conf := p.confs[rootKey]
+	for _, key := range p.withShutdownKey(p.keys, p.handleSignals) {
 		initFlag(p.rootCommand, key)
-		p.bindRootKey(p.rootCommand, key.name)
+		p.bindRootKey(p.rootCommand, conf, key)
+		conf.keys[key.name].declared = true
 	}
 }
 
-func (p *pungiBuilder) initSubCommand(cmd *Command) {
+// Without a root runnable the keys have no flags. The root config still reads them, see `Pungi.RootConfig`.
+func (p *pungiBuilder) bindRootKeysWithoutFlags() {
+	conf := p.confs[rootKey]
+	for _, key := range p.keys {
+		p.bindRootKey(nil, conf, key)
+		conf.keys[key.name].declared = true
+	}
+}
 
-	var conf = &Conf{appName: p.appName, cmdName: cmd.cmdName}
-	runnable := cmd.runnable
-	p.confs[cmd.cmdName] = conf
+// Commands and their subcommands
+func allCommands(commands map[string]*Command) []*Command {
+	var all []*Command
+	for _, cmd := range commands {
+		all = append(all, cmd)
+		all = append(all, allCommands(cmd.commands)...)
+	}
+	return all
+}
 
-	cobraRun := func(cobraCmd *cobra.Command, args []string) error {
-		return runnable(conf, args)
+// Subcommands inherit the keys of their parents.
+// parentPath - space separated names of the parent commands, empty for top level commands.
+func (p *pungiBuilder) initSubCommand(pungi *Pungi, parent *cobra.Command, parentPath string, parentKeys map[string]*key, cmd *Command) {
+	cmdPath := strings.TrimSpace(parentPath + " " + cmd.cmdName)
+	var conf = newConf(p.appName, cmdPath, p.store)
+	p.confs[cmdPath] = conf
+
+	var cobraRun func(cobraCmd *cobra.Command, args []string) error
+	if cmd.runnable != nil {
+		cobraRun = func(cobraCmd *cobra.Command, args []string) error {
+			if err := conf.validate(); err != nil {
+				return err
+			}
+			return pungi.run(cmd.runnable, cmd.handleSignals, conf, args)
+		}
 	}
 	cobraCmd := &cobra.Command{
 		Use:   cmd.usageText,
@@ -175,29 +253,33 @@ func (p *pungiBuilder) initSubCommand(cmd *Command) {
 		RunE:  cobraRun,
 	}
 
-	p.rootCommand.AddCommand(cobraCmd)
+	parent.AddCommand(cobraCmd)
 
-	allKeys := merge(p.keys, cmd.keys)
+	allKeys := p.withShutdownKey(merge(parentKeys, cmd.keys), cmd.handleSignals)
 	for _, key := range allKeys {
 		initFlag(cobraCmd, key)
-		p.bindSubCmdKey(cobraCmd, cmd.cmdName, key.name)
+		p.bindSubCmdKey(cobraCmd, conf, key)
+		conf.keys[key.name].declared = parentKeys[key.name] != key
+	}
+
+	for _, sub := range cmd.commands {
+		p.initSubCommand(pungi, cobraCmd, cmdPath, merge(parentKeys, cmd.keys), sub)
 	}
 }
 
 func (p *pungiBuilder) initRootCommand(pungi *Pungi) {
-	var cfgFile string
-	cobra.OnInitialize(func() {
-		if err := p.initViper(pungi, cfgFile); err != nil {
-			panic(err)
-		}
-	})
+	cfgFiles := &configFlag{}
+	pungi.configFlag = cfgFiles
 
-	p.confs[rootKey] = newRootConf(p.appName)
+	p.confs[rootKey] = newConf(p.appName, "", p.store)
 	var rootRunnable func(cmd *cobra.Command, args []string) error
 
 	if p.runnable != nil {
 		rootRunnable = func(cobraCmd *cobra.Command, args []string) error {
-			return p.runnable(p.confs[rootKey], args)
+			if err := p.confs[rootKey].validate(); err != nil {
+				return err
+			}
+			return pungi.run(p.runnable, p.handleSignals, p.confs[rootKey], args)
 		}
 	}
 
@@ -206,49 +288,93 @@ func (p *pungiBuilder) initRootCommand(pungi *Pungi) {
 		Short: p.desc,
 		Args:  p.args,
 		RunE:  rootRunnable,
+		// Runs for the root and every subcommand, scoped to this instance unlike `cobra.OnInitialize`.
+		// Flags and arguments are parsed before.
+		PersistentPreRunE: func(cobraCmd *cobra.Command, args []string) error {
+			if err := p.initRootFlags(pungi, cobraCmd); err != nil {
+				return err
+			}
+			return p.initViper(pungi, cfgFiles.paths)
+		},
 	}
 
-	p.rootCommand.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is config.toml)")
+	p.rootCommand.PersistentFlags().Var(cfgFiles, "config", "config file, can be repeated (default is config.toml)")
 }
 
-func (p *pungiBuilder) bindSubCmdKey(command *cobra.Command, cmdName, key string) {
-	confKey := formatCommandConfKey(p.appName, cmdName, key)
-	envKey := formatCommandEnvKey(p.appName, cmdName, key)
-
-	if err := viper.BindPFlag(confKey, command.Flags().Lookup(key)); err != nil {
-		panic(err)
+// Applies the persistent flags of the root command, before the configuration is loaded.
+func (p *pungiBuilder) initRootFlags(pungi *Pungi, cobraCmd *cobra.Command) error {
+	pungi.argsParsed = true
+	if err := pungi.initVerbosity(cobraCmd); err != nil {
+		return err
 	}
-	if err := viper.BindEnv(confKey, envKey); err != nil {
-		panic(err)
+	if err := pungi.initProfile(cobraCmd); err != nil {
+		return err
 	}
+	pungi.initConfigFormat(cobraCmd)
+	p.initConfigURL(cobraCmd)
+	return nil
 }
 
-func (p *pungiBuilder) bindRootKey(command *cobra.Command, key string) {
-	confKey := formatRootConfKey(p.appName, key)
-	envKey := formatRootEnvKey(p.appName, key)
+func (p *pungiBuilder) bindSubCmdKey(command *cobra.Command, conf *Conf, key *key) {
+	confKey := formatCommandConfKey(p.appName, conf.cmdName, key.name)
+	envKey := formatCommandEnvKey(p.appName, conf.cmdName, key.name)
+	p.bindKey(command, conf, key, confKey, envKey)
+}
 
-	if err := viper.BindPFlag(confKey, command.Flags().Lookup(key)); err != nil {
-		panic(err)
+func (p *pungiBuilder) bindRootKey(command *cobra.Command, conf *Conf, key *key) {
+	confKey := formatRootConfKey(p.appName, key.name)
+	envKey := formatRootEnvKey(p.appName, key.name)
+	p.bindKey(command, conf, key, confKey, envKey)
+}
+
+// command - nil for keys without a flag
+func (p *pungiBuilder) bindKey(command *cobra.Command, conf *Conf, key *key, confKey, envKey string) {
+	var keyFlag *flag.Flag
+	if command != nil {
+		keyFlag = command.Flags().Lookup(key.name)
+		if err := p.store.BindPFlag(confKey, keyFlag); err != nil {
+			panic(err)
+		}
+	} else {
+		p.store.SetDefault(confKey, key.value)
 	}
-	if err := viper.BindEnv(confKey, envKey); err != nil {
+	if err := p.store.BindEnv(confKey, envKey); err != nil {
 		panic(err)
 	}
+	bound := &boundKey{
+		key:      key,
+		confKey:  confKey,
+		envKey:   envKey,
+		fileKeys: conf.fileKeys(key.name),
+		flag:     keyFlag,
+	}
+	conf.keys[key.name] = bound
+	p.store.keys = append(p.store.keys, bound)
+	p.store.index[confKey] = bound
 }
 
 func (p *pungiBuilder) validateKeys() error {
 	allKeys := p.keys
-	for _, cmd := range p.commands {
+	for _, cmd := range allCommands(p.commands) {
 		allKeys = merge(allKeys, cmd.keys)
 	}
+	for _, reserved := range []string{verbosityFlag, profileFlag} {
+		if _, ok := allKeys[reserved]; ok {
+			return errors.Errorf("Key name %q is reserved for the %s flag.", reserved, reserved)
+		}
+	}
 	for _, key := range allKeys {
 		switch key.value.(type) {
-		case string:
-		case int:
-		case bool:
-		case float64:
+		case string, int, int64, uint, uint64, bool, float64:
+		case time.Duration, time.Time:
+		case []string, []int, map[string]string:
+		case Value:
 		default:
 			return errors.New("Not suppored value type: " + reflect.TypeOf(key.value).String())
 		}
+		if err := validateBounds(key); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -264,48 +390,100 @@ func initFlag(command *cobra.Command, key *key) {
 		command.Flags().Bool(key.name, v, key.desc)
 	case float64:
 		command.Flags().Float64(key.name, v, key.desc)
+	case int64:
+		command.Flags().Int64(key.name, v, key.desc)
+	case uint:
+		command.Flags().Uint(key.name, v, key.desc)
+	case uint64:
+		command.Flags().Uint64(key.name, v, key.desc)
+	case time.Duration:
+		command.Flags().Duration(key.name, v, key.desc)
+	case time.Time:
+		timeVar(command.Flags(), key.name, v, key.desc)
+	case []string:
+		command.Flags().StringSlice(key.name, v, key.desc)
+	case []int:
+		command.Flags().IntSlice(key.name, v, key.desc)
+	case map[string]string:
+		command.Flags().StringToString(key.name, v, key.desc)
+	case Value:
+		command.Flags().Var(cloneValue(v), key.name, key.desc)
 	default:
 		panic("Unknown value type: " + reflect.TypeOf(key.value).String())
 	}
+	if key.sensitive {
+		redactDefault(command.Flags().Lookup(key.name))
+	}
 }
 
-func (p *pungiBuilder) initViper(pungi *Pungi, cfgFileFlag string) error {
-	if cfgFileFlag != "" {
-		viper.SetConfigFile(cfgFileFlag)
-	} else {
-		if cfgFileFromEnv := os.Getenv(formatRootEnvKey(p.appName, "CONFIG")); cfgFileFromEnv != "" {
-			viper.SetConfigFile(cfgFileFromEnv)
-		} else {
-			viper.SetConfigFile(p.defaultConfigFile)
-		}
+// cfgFilesFlag - values of the `--config` flag. Without the flag `APP_CONFIG` is used, a path list: `a.toml:b.toml`
+func (p *pungiBuilder) initViper(pungi *Pungi, cfgFilesFlag []string) error {
+	store := p.store
+	cfgFiles := cfgFilesFlag
+	if len(cfgFiles) == 0 {
+		cfgFiles = splitPathList(os.Getenv(formatRootEnvKey(p.appName, "CONFIG")))
 	}
-	viper.SetEnvPrefix(p.appName)
-	viper.AutomaticEnv()
+	store.automaticEnv(p.appName)
 
-	err := viper.ReadInConfig()
-	if err == nil {
-		println("Using config file: " + viper.ConfigFileUsed())
-	} else {
-		if viper.ConfigFileUsed() == p.defaultConfigFile {
-			println("Default config file not found")
-			err = nil
-		} else {
-			_, _ = fmt.Fprintf(os.Stderr, "Could not load config from %s\n Error: %v", viper.ConfigFileUsed(), err)
-		}
+	pungi.findConfigFiles = func() (configFiles, error) {
+		return p.findConfigFiles(pungi, cfgFiles)
 	}
-	pungi.configFileUsed = viper.ConfigFileUsed()
-	return err
+	files, err := pungi.findConfigFiles()
+	if err != nil {
+		return ConfigError(err)
+	}
+	if err := pungi.checkUnknownKeys(files); err != nil {
+		return err
+	}
+	if err := store.useFiles(files); err != nil {
+		return ConfigError(err)
+	}
+	for _, file := range files {
+		pungi.logf(VerbosityInfo, "Using config file: %s", file.name)
+	}
+	if err := pungi.loadSources(); err != nil {
+		return ConfigError(err)
+	}
+	pungi.configFilesUsed = files.names()
+	pungi.configFileUsed = p.defaultConfigFile
+	if len(files) > 0 {
+		pungi.configFileUsed = files[len(files)-1].name
+	}
+	if pungi.watchConfig {
+		return ConfigError(pungi.startWatching())
+	}
+	return nil
 }
 
 type pungiBuilder struct {
 	appName, usageText, desc string
 	keys                     map[string]*key
 	commands                 map[string]*Command
-	runnable                 Runnable
+	runnable                 RunnableContext
+	handleSignals            bool
+	shutdownTimeout          time.Duration
 	confs                    map[string]*Conf
 	rootCommand              *cobra.Command
 	defaultConfigFile        string
 	args                     cobra.PositionalArgs
+	store                    *configStore
+	configCommand            bool
+	watchConfig              bool
+	unknownKeys              unknownKeysMode
+	panicOnUndeclared        bool
+	reportUnread             bool
+	secrets                  SecretProvider
+	interpolate              bool
+	sources                  []*sourceLayer
+	configURL                *HTTPSource
+	precedence               []Layer
+	searchPath               []string
+	in                       io.Reader
+	out, errOut              io.Writer
+	logger                   Logger
+	verbosity                int
+	// First error from building, returned by `Initialize`
+	err error
 }
 
 type Runnable = func(conf *Conf, args []string) error
@@ -313,6 +491,23 @@ type Runnable = func(conf *Conf, args []string) error
 type key struct {
 	name, desc string
 	value      interface{}
+	required   bool
+	sensitive  bool
+	rules      []rule
+	// Arguments of `Min` and `Max`, see `validateBounds`
+	bounds []interface{}
+}
+
+func newKey(name string, value interface{}, desc string, options []KeyOption) *key {
+	k := &key{
+		name:  name,
+		value: value,
+		desc:  desc,
+	}
+	for _, option := range options {
+		option(k)
+	}
+	return k
 }
 
 // Pungi contains all computed configurations.
@@ -321,7 +516,34 @@ type Pungi struct {
 	confs          map[string]*Conf
 	rootCmd        *cobra.Command
 	configFileUsed string
-	appName        string
+	// All config files in merge order
+	configFilesUsed []string
+	configFlag      *configFlag
+	// Source of the `--config-url` flag, nil without `ConfigURL`
+	configURL *HTTPSource
+	// Value of the `--profile` flag
+	profile string
+	// Value of the `--config-format` flag
+	configFormat string
+	// Finds the config files again on reload, nil if the files are fixed
+	findConfigFiles func() (configFiles, error)
+	appName         string
+	store           *configStore
+	watchConfig     bool
+	unknownKeys     unknownKeysMode
+	reportUnread    bool
+	secrets         SecretProvider
+	watcher         *watcher
+	reloadMu        sync.Mutex
+	// Context given to `ExecuteContext`
+	ctx   context.Context
+	ctxMu sync.Mutex
+	// False if the execution failed on parsing the flags or arguments
+	argsParsed                  bool
+	in                          io.Reader
+	out, errOut                 io.Writer
+	logger                      Logger
+	verbosity, defaultVerbosity int
 }
 
 // Returns the root config. The values that are shared by commands
@@ -331,35 +553,53 @@ func (p *Pungi) RootConfig() *Conf {
 		p.confs = make(map[string]*Conf)
 	}
 	if _, ok := p.confs[rootKey]; !ok {
-		p.confs[rootKey] = newRootConf(p.appName)
+		p.confs[rootKey] = newConf(p.appName, "", p.store)
 	}
 	return p.confs[rootKey]
 }
 
-func newRootConf(appName string) *Conf {
-	return &Conf{appName: appName}
-}
-
-// Returns specific command configuration
+// Returns specific command configuration. Subcommands are separated by space: `Config("db migrate")`
 func (p *Pungi) Config(cmdName string) *Conf {
 	if conf, ok := p.confs[cmdName]; ok {
 		return conf
 	}
-	return &Conf{
-		appName: p.appName,
-		cmdName: cmdName,
-	}
+	return newConf(p.appName, cmdName, p.store)
 }
 
-// Returns the config file name that is used
+// Returns the config file name with the highest precedence. The default config file if no file was found.
 func (p *Pungi) ConfigFileUsed() string {
 	return p.configFileUsed
 }
 
+// Returns the config files that were read, later files override earlier ones.
+func (p *Pungi) ConfigFilesUsed() []string {
+	return append([]string(nil), p.configFilesUsed...)
+}
+
+// Errors from parsing the flags and arguments are returned as `ExitUsage` errors,
+// errors from loading the config file as `ExitConfig` errors. See `ExitCode`.
+//
 // args - arguments for executable. By default: `os.Args[1:]`
 func (p *Pungi) Execute(args ...string) error {
 	if len(args) > 0 {
 		p.rootCmd.SetArgs(args)
 	}
-	return p.rootCmd.Execute()
+	defer p.stopWatching()
+	p.argsParsed = false
+	if p.configFlag != nil {
+		p.configFlag.paths = nil
+	}
+	p.resetConfigURL()
+	for _, conf := range p.confs {
+		conf.resetReads()
+	}
+	p.store.clearListeners()
+	cmd, err := p.rootCmd.ExecuteC()
+	if err != nil && !p.argsParsed {
+		err = UsageError(err)
+	}
+	if err != nil {
+		p.printError(cmd, err)
+	}
+	return err
 }
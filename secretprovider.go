@@ -0,0 +1,166 @@
+package pungi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Config file values with the prefix are resolved by the secret provider: `dbUri = "secret://db/uri"`
+const secretRefPrefix = "secret://"
+
+// SecretProvider resolves `secret://` references in config files.
+type SecretProvider interface {
+	// name - reference without the prefix, e.g. `db/uri`
+	Secret(name string) (string, error)
+}
+
+// Resolves `secret://` references in config files with the provider. The references are resolved when the
+// config files are loaded, before the runnable is called.
+func (p *pungiBuilder) Secrets(provider SecretProvider) *pungiBuilder {
+	p.secrets = provider
+	return p
+}
+
+// Replaces `secret://` references in the files with the values from the provider.
+func resolveSecrets(files configFiles, provider SecretProvider) error {
+	resolve := func(value string) (string, error) {
+		if provider == nil {
+			return "", errors.Errorf("Could not resolve %s: no secret provider", value)
+		}
+		secret, err := provider.Secret(strings.TrimPrefix(value, secretRefPrefix))
+		return secret, errors.Wrapf(err, "Could not resolve %s", value)
+	}
+	for _, file := range files {
+		if err := file.resolveRefs(secretRefPrefix, resolve); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncryptedFileProvider reads secrets from a local file of `name=value` lines. The values are encrypted
+// with AES-256-GCM, see `config encrypt-value`. Empty lines and `#` comments are skipped.
+type EncryptedFileProvider struct {
+	path, keyEnv, keyFile string
+}
+
+// path - the secrets file
+//
+// keyEnv - env variable holding the base64 encoded 32 byte key, e.g. `TESTAPP_SECRET_KEY`
+//
+// keyFile - file holding the key, used when the env variable is not set. May be empty.
+func NewEncryptedFileProvider(path, keyEnv, keyFile string) *EncryptedFileProvider {
+	return &EncryptedFileProvider{path: path, keyEnv: keyEnv, keyFile: keyFile}
+}
+
+// The file is read on every call, so changes are seen on reload.
+func (p *EncryptedFileProvider) Secret(name string) (string, error) {
+	content, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == name {
+			return p.Decrypt(name, strings.TrimSpace(kv[1]))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.Errorf("secret %s not found in %s", name, p.path)
+}
+
+// Encrypts the value of the named secret. Returns the base64 encoded nonce and ciphertext.
+// The name is authenticated, the value can't be moved to another name.
+func (p *EncryptedFileProvider) Encrypt(name, value string) (string, error) {
+	gcm, err := p.cipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), []byte(name))), nil
+}
+
+// Decrypts a value returned by `Encrypt`.
+func (p *EncryptedFileProvider) Decrypt(name, encrypted string) (string, error) {
+	gcm, err := p.cipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errors.Errorf("secret %s is not a valid encrypted value", name)
+	}
+	value, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return "", errors.Errorf("secret %s could not be decrypted, wrong key?", name)
+	}
+	return string(value), nil
+}
+
+func (p *EncryptedFileProvider) cipher() (cipher.AEAD, error) {
+	encoded := os.Getenv(p.keyEnv)
+	if encoded == "" && p.keyFile != "" {
+		content, err := ioutil.ReadFile(p.keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not read the secret key")
+		}
+		encoded = string(content)
+	}
+	if encoded == "" {
+		return nil, errors.Errorf("secret key not set, set %s", p.keyEnv)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("secret key must be 32 bytes, base64 encoded")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// `config encrypt-value <name> [value]`, the value is read from stdin when not given
+func encryptValue(provider SecretProvider, in io.Reader, out io.Writer, args []string) error {
+	encrypter, ok := provider.(*EncryptedFileProvider)
+	if !ok {
+		return errors.New("encrypt-value needs an EncryptedFileProvider, see Secrets()")
+	}
+	var value string
+	if len(args) > 1 {
+		value = args[1]
+	} else {
+		content, err := ioutil.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimRight(string(content), "\r\n")
+	}
+	encrypted, err := encrypter.Encrypt(args[0], value)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s=%s\n", args[0], encrypted)
+	return err
+}
@@ -0,0 +1,160 @@
+package pungi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+// Shown instead of the values of sensitive keys
+const redacted = "******"
+
+// Env variables with the suffix name a file holding the value: `TESTAPP_GRPC_DBURI_FILE=/run/secrets/db`
+const secretFileSuffix = "_FILE"
+
+// Config file values with the prefix are read from the file: `dbUri = "@file:/run/secrets/db"`
+const fileRefPrefix = "@file:"
+
+// The value is redacted in help defaults, `AllValues`, the `config` command output and error messages.
+func Sensitive() KeyOption {
+	return func(k *key) {
+		k.sensitive = true
+	}
+}
+
+// Hides the default value in the help of the flag
+func redactDefault(keyFlag *flag.Flag) {
+	if keyFlag.DefValue != "" {
+		keyFlag.DefValue = redacted
+	}
+}
+
+// Replaces the secret in messages like `must match ^boltdb:, got "secret"`
+func redactMessage(msg string, secret interface{}) string {
+	s := valueString(secret)
+	if s == "" {
+		return msg
+	}
+	msg = strings.Replace(msg, strconv.Quote(s), strconv.Quote(redacted), -1)
+	return strings.Replace(msg, s, redacted, -1)
+}
+
+// True if the key is declared sensitive or its value is resolved from a `secret://` or `@file:` reference.
+func (s *configStore) isSensitive(k *boundKey) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sensitive(k)
+}
+
+// The caller holds the lock.
+func (s *configStore) sensitive(k *boundKey) bool {
+	if k.sensitive {
+		return true
+	}
+	source, fileKey, file := s.find(k)
+	if env := s.files.findEnv(k); source.Layer == LayerEnv && env != nil && env.name == source.Name {
+		// Variable of a .env file
+		return env.resolved[k.envKey]
+	}
+	return file != nil && file.resolved[fileKey]
+}
+
+// Replaces the values of sensitive keys in settings returned by `AllSettings`.
+func (s *configStore) redactSettings(settings map[string]interface{}) {
+	for _, k := range s.keys {
+		if !s.sensitive(k) {
+			continue
+		}
+		path := strings.Split(k.confKey, ".")
+		section := settings
+		for _, part := range path[:len(path)-1] {
+			if section, _ = section[part].(map[string]interface{}); section == nil {
+				break
+			}
+		}
+		if _, ok := section[path[len(path)-1]]; ok {
+			section[path[len(path)-1]] = redacted
+		}
+	}
+}
+
+// Returns the value from the file named by the `_FILE` env variable of the key, false if the variable is not set.
+func secretFromFile(k *boundKey) (string, bool, error) {
+	path := os.Getenv(k.envKey + secretFileSuffix)
+	if path == "" {
+		return "", false, nil
+	}
+	secret, err := readSecretFile(path)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "Could not read %s%s", k.envKey, secretFileSuffix)
+	}
+	return secret, true, nil
+}
+
+// Trailing newlines are not part of the secret
+func readSecretFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// Replaces `@file:` references with the content of the files. Relative paths are relative to the config file.
+func resolveFileRefs(file *configFile) error {
+	return file.resolveRefs(fileRefPrefix, func(value string) (string, error) {
+		path := strings.TrimPrefix(value, fileRefPrefix)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file.name), path)
+		}
+		secret, err := readSecretFile(path)
+		return secret, errors.Wrapf(err, "Could not resolve %s", value)
+	})
+}
+
+// Replaces the string values starting with the prefix, .env variables included. The values are redacted like the
+// values of sensitive keys, see `configStore.sensitive`.
+func (file *configFile) resolveRefs(prefix string, resolve func(value string) (string, error)) error {
+	if file.resolved == nil {
+		file.resolved = make(map[string]bool)
+	}
+	for name, value := range file.env {
+		if strings.HasPrefix(value, prefix) {
+			secret, err := resolve(value)
+			if err != nil {
+				return err
+			}
+			file.env[name] = secret
+			file.resolved[name] = true
+		}
+	}
+	var refs []string
+	findRefs(file.values.AllSettings(), "", prefix, &refs)
+	for _, fileKey := range refs {
+		secret, err := resolve(file.values.GetString(fileKey))
+		if err != nil {
+			return err
+		}
+		file.values.Set(fileKey, secret)
+		file.resolved[fileKey] = true
+	}
+	return nil
+}
+
+func findRefs(section map[string]interface{}, path, prefix string, refs *[]string) {
+	for name, value := range section {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			findRefs(v, path+name+".", prefix, refs)
+		case string:
+			if strings.HasPrefix(v, prefix) {
+				*refs = append(*refs, path+name)
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package pungi
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/viper"
+)
+
+// Layer is the configuration source a value was taken from.
+type Layer string
+
+const (
+	LayerSet     Layer = "set"
+	LayerFlag    Layer = "flag"
+	LayerEnv     Layer = "env"
+	LayerFile    Layer = "file"
+	LayerDefault Layer = "default"
+	// Added with `ConfigSource`
+	LayerSource Layer = "source"
+)
+
+// Source tells where a configuration value came from.
+type Source struct {
+	Layer Layer
+	// Flag (`--port`), env variable (`TESTAPP_PORT`) or config file name. Empty for defaults.
+	Name string
+	// Line in the config file, 0 if unknown.
+	Line int
+}
+
+func (s Source) String() string {
+	switch {
+	case s.Name == "":
+		return string(s.Layer)
+	case s.Line > 0:
+		return fmt.Sprintf("%s %s:%d", s.Layer, s.Name, s.Line)
+	default:
+		return fmt.Sprintf("%s %s", s.Layer, s.Name)
+	}
+}
+
+// configFile holds the values of one config file, used to find out where a value came from.
+type configFile struct {
+	name string
+	// Config type by extension, e.g. "toml"
+	format  string
+	content []byte
+	values  *viper.Viper
+	// Parsed TOML for line numbers, nil for other formats
+	tree *toml.Tree
+	// Variables of a .env file and their lines, nil for other formats
+	env      map[string]string
+	envLines map[string]int
+	// Config file paths and .env variables resolved from a `secret://` or `@file:` reference, see `resolveRefs`
+	resolved map[string]bool
+}
+
+// configFiles are config files in merge order, later files override earlier ones.
+type configFiles []*configFile
+
+// Returns the most specific config file path of the key that is set in any of the files
+// and the last file that sets it. Empty and nil if none does. Profile sections come before their parent section.
+func (files configFiles) find(k *boundKey, profile string) (string, *configFile) {
+	for _, fileKey := range profileKeys(k.fileKeys, profile) {
+		for i := len(files) - 1; i >= 0; i-- {
+			if files[i].values.IsSet(fileKey) {
+				return fileKey, files[i]
+			}
+		}
+	}
+	return "", nil
+}
+
+func (files configFiles) names() []string {
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.name
+	}
+	return names
+}
+
+// TOML keys are case sensitive, config keys are not.
+func (f *configFile) line(confKey string) int {
+	tree := f.tree
+	if tree == nil {
+		return 0
+	}
+	path := strings.Split(confKey, ".")
+	for i, part := range path {
+		var match string
+		for _, k := range tree.Keys() {
+			if strings.EqualFold(k, part) {
+				match = k
+			}
+		}
+		if match == "" {
+			return 0
+		}
+		if i == len(path)-1 {
+			return tree.GetPosition(match).Line
+		}
+		sub, ok := tree.Get(match).(*toml.Tree)
+		if !ok {
+			return 0
+		}
+		tree = sub
+	}
+	return 0
+}
+
+// Returns where the value of the key came from.
+func (c *Conf) Source(key string) Source {
+	return c.store.source(c.boundKey(key))
+}
+
+// Returns a report of every declared key with its value and source. One key per line:
+//
+//	port        6666                     file config.toml:8
+//	cpuprofile  true                     env TESTAPP_HTTPGW_CPUPROFILE
+//	grpcUri     http://localhost:5432    default
+func (c *Conf) Explain() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	for _, name := range c.keyNames() {
+		value, err := c.typedValue(c.keys[name].key)
+		switch {
+		case c.store.isSensitive(c.keys[name]):
+			value = redacted
+		case err != nil:
+			value = fmt.Sprintf("<%v>", err)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", name, valueString(value), c.Source(name))
+	}
+	_ = w.Flush()
+	return buf.String()
+}
+
+// Declared keys are bound when the command is initialized. Other keys use the same naming.
+func (c *Conf) boundKey(name string) *boundKey {
+	if k, ok := c.keys[name]; ok {
+		return k
+	}
+	envKey := formatRootEnvKey(c.appName, name)
+	if c.cmdName != "" {
+		envKey = formatCommandEnvKey(c.appName, c.cmdName, name)
+	}
+	return &boundKey{
+		key:      &key{name: name},
+		confKey:  c.fullKey(name),
+		envKey:   envKey,
+		fileKeys: c.fileKeys(name),
+	}
+}
+
+func (c *Conf) keyNames() []string {
+	names := make([]string, 0, len(c.keys))
+	for name := range c.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,206 @@
+package pungi
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// ConfigSource provides configuration values from outside of the config files, e.g. from a config service,
+// a settings table or a Kubernetes ConfigMap directory. Sources that change by themselves implement `SourceWatcher`.
+type ConfigSource interface {
+	// Shown as the source of the values, e.g. the URL
+	Name() string
+	// Returns the values in the layout of the config files: `{"testapp": {"grpc": {"port": 5432}}}`.
+	// On errors the last known good values may be returned with the error, they are used with a warning.
+	Load() (map[string]interface{}, error)
+}
+
+// SourceWatcher is implemented by config sources that change by themselves, e.g. polled over HTTP.
+// With `WatchConfig` the source is loaded again after `changed` is called.
+type SourceWatcher interface {
+	// Calls `changed` when the values change, with an error when checking for changes failed. Returns when `done` is closed.
+	Watch(done <-chan struct{}, changed func(err error))
+}
+
+// Layers from the highest precedence
+var defaultPrecedence = []Layer{LayerSet, LayerFlag, LayerEnv, LayerFile, LayerDefault}
+
+// Returns a source with fixed values in the layout of the config files, e.g. for tests.
+func MapSource(name string, values map[string]interface{}) ConfigSource {
+	return &mapSource{name: name, values: values}
+}
+
+type mapSource struct {
+	name   string
+	values map[string]interface{}
+}
+
+func (s *mapSource) Name() string {
+	return s.name
+}
+
+func (s *mapSource) Load() (map[string]interface{}, error) {
+	return s.values, nil
+}
+
+// sourceLayer holds the values of a config source and its place in the precedence.
+type sourceLayer struct {
+	source ConfigSource
+	// The source overrides this layer and the layers below it
+	above Layer
+	// Values in the layout of a config file, nil if not loaded
+	file *configFile
+	// Nil for sources that are always used
+	enabled func() bool
+}
+
+// Adds a config source. Its values override the `above` layer: `LayerFlag`, `LayerEnv`, `LayerFile` or `LayerDefault`.
+// E.g. with `LayerFile` the source overrides the config files, but env variables override the source.
+// Sources added later override earlier ones in the same place. With `WatchConfig` changing sources are reloaded.
+func (p *pungiBuilder) ConfigSource(source ConfigSource, above Layer) *pungiBuilder {
+	switch above {
+	case LayerFlag, LayerEnv, LayerFile, LayerDefault:
+	default:
+		if p.err == nil {
+			p.err = errors.Errorf("Config source %s can't be placed above the %q layer", source.Name(), above)
+		}
+	}
+	p.sources = append(p.sources, &sourceLayer{source: source, above: above})
+	return p
+}
+
+// Reorders the flag, env and file layers, from the highest precedence. Values set with `Conf.Set` still override
+// all layers and defaults are still used last. E.g. `Precedence(LayerFlag, LayerFile, LayerEnv)` lets the config
+// files override env variables. Config sources stay above their layer.
+func (p *pungiBuilder) Precedence(layers ...Layer) *pungiBuilder {
+	order := append([]Layer{LayerSet}, layers...)
+	order = append(order, LayerDefault)
+	if !isPermutation(order, defaultPrecedence) {
+		if p.err == nil {
+			p.err = errors.Errorf("Precedence must order the %q, %q and %q layers, got %q", LayerFlag, LayerEnv, LayerFile, layers)
+		}
+		return p
+	}
+	p.precedence = order
+	return p
+}
+
+func isPermutation(layers, all []Layer) bool {
+	if len(layers) != len(all) {
+		return false
+	}
+	seen := make(map[Layer]bool)
+	for _, layer := range layers {
+		seen[layer] = true
+	}
+	for _, layer := range all {
+		if !seen[layer] {
+			return false
+		}
+	}
+	return true
+}
+
+// The caller holds the lock.
+func (s *configStore) layers() []Layer {
+	if s.order != nil {
+		return s.order
+	}
+	return defaultPrecedence
+}
+
+// Loads the values of every enabled source.
+func (p *Pungi) loadSources() error {
+	for _, layer := range p.store.sources {
+		if layer.enabled != nil && !layer.enabled() {
+			p.store.mu.Lock()
+			layer.file = nil
+			p.store.mu.Unlock()
+			continue
+		}
+		file, err := p.loadSource(layer)
+		if err != nil {
+			return err
+		}
+		p.store.mu.Lock()
+		layer.file = file
+		p.store.mu.Unlock()
+		p.logf(VerbosityInfo, "Using config source: %s", layer.source.Name())
+	}
+	return nil
+}
+
+func (p *Pungi) loadSource(layer *sourceLayer) (*configFile, error) {
+	name := layer.source.Name()
+	values, err := layer.source.Load()
+	if err != nil && values == nil {
+		return nil, errors.Wrapf(err, "Could not load config from %s", name)
+	}
+	if err != nil {
+		p.logf(VerbosityInfo, "Warning: config source %s: %v", name, err)
+	}
+	file := &configFile{name: name, values: viper.New()}
+	if err := file.values.MergeConfigMap(values); err != nil {
+		return nil, err
+	}
+	return file, resolveSecrets(configFiles{file}, p.secrets)
+}
+
+// Reloads a changed source like `Reload` reloads the config files.
+func (p *Pungi) reloadSource(source ConfigSource) error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	p.store.mu.RLock()
+	files := p.store.files
+	sources := append([]*sourceLayer(nil), p.store.sources...)
+	p.store.mu.RUnlock()
+	for i, layer := range sources {
+		if layer.source != source {
+			continue
+		}
+		file, err := p.loadSource(layer)
+		if err != nil {
+			return err
+		}
+		sources[i] = &sourceLayer{source: source, above: layer.above, file: file, enabled: layer.enabled}
+	}
+	return p.useStaged(files, sources)
+}
+
+// Stops when the watcher stops
+func (p *Pungi) watchSources(done <-chan struct{}) {
+	for _, layer := range p.store.sources {
+		w, ok := layer.source.(SourceWatcher)
+		if !ok || layer.file == nil {
+			continue
+		}
+		source := layer.source
+		go w.Watch(done, func(err error) {
+			name := source.Name()
+			if err == nil {
+				err = p.reloadSource(source)
+			}
+			if err != nil {
+				p.logf(VerbosityInfo, "Could not reload config from %s, keeping the old config\n Error: %v", name, err)
+			} else {
+				p.logf(VerbosityInfo, "Reloaded config from %s", name)
+			}
+		})
+	}
+}
+
+// Returns the config source that sets the key and is placed above the layer, nil if none does.
+// The caller holds the lock.
+func (s *configStore) findInSources(k *boundKey, above Layer) (Source, string, *configFile) {
+	for i := len(s.sources) - 1; i >= 0; i-- {
+		layer := s.sources[i]
+		if layer.above != above || layer.file == nil {
+			continue
+		}
+		if fileKey, file := (configFiles{layer.file}).find(k, s.profile); file != nil {
+			return Source{Layer: LayerSource, Name: layer.source.Name()}, fileKey, file
+		}
+	}
+	return Source{}, "", nil
+}
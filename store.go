@@ -0,0 +1,280 @@
+package pungi
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configStore holds the configuration of one Pungi instance. It is shared by all of its Confs.
+// Reads and writes are guarded, the config file may be reloaded while runnables read values.
+type configStore struct {
+	*viper.Viper
+	// Config files that were read, later files override earlier ones
+	files configFiles
+	// Active profile, empty if none
+	profile string
+	// True if the keys are declared with a builder, see `Conf.declaredName`
+	keysDeclared      bool
+	panicOnUndeclared bool
+	// Expand `${...}` references, see `Interpolate`
+	interpolate bool
+	// Prefix of the env variables of undeclared keys
+	envPrefix string
+
+	mu        sync.RWMutex
+	overrides map[string]bool
+	listeners []*listener
+	// Keys of all commands
+	keys []*boundKey
+	// Keys of all commands by conf key
+	index map[string]*boundKey
+	// Config sources in the order they were added
+	sources []*sourceLayer
+	// Layers from the highest precedence, nil for the default order. See `Precedence`.
+	order []Layer
+}
+
+func newConfigStore() *configStore {
+	return &configStore{
+		Viper:     viper.New(),
+		overrides: make(map[string]bool),
+		index:     make(map[string]*boundKey),
+	}
+}
+
+// boundKey is a key bound to the flag, env variable and config file path of one command.
+type boundKey struct {
+	*key
+	confKey, envKey string
+	// Config file paths, the first one that is set is used. See `Conf.fileKeys`.
+	fileKeys []string
+	flag     *flag.Flag
+	// False if the key is inherited from a parent command
+	declared bool
+}
+
+// Reads env variables of undeclared keys too.
+func (s *configStore) automaticEnv(prefix string) {
+	s.envPrefix = prefix
+	s.SetEnvPrefix(prefix)
+	s.AutomaticEnv()
+}
+
+// Returns a copy of the store with other config files and sources, to validate them before they are used.
+// The copy shares the keys, flags and env variables. See `swap`.
+func (s *configStore) stage(files configFiles, sources []*sourceLayer) (*configStore, error) {
+	s.mu.RLock()
+	staged := &configStore{
+		Viper:             viper.New(),
+		profile:           s.profile,
+		keysDeclared:      s.keysDeclared,
+		panicOnUndeclared: s.panicOnUndeclared,
+		interpolate:       s.interpolate,
+		keys:              s.keys,
+		index:             s.index,
+		sources:           sources,
+		order:             s.order,
+		overrides:         make(map[string]bool),
+	}
+	for _, k := range s.keys {
+		if k.flag != nil {
+			if err := staged.BindPFlag(k.confKey, k.flag); err != nil {
+				s.mu.RUnlock()
+				return nil, err
+			}
+		} else {
+			staged.SetDefault(k.confKey, k.value)
+		}
+		if err := staged.BindEnv(k.confKey, k.envKey); err != nil {
+			s.mu.RUnlock()
+			return nil, err
+		}
+	}
+	staged.copyOverrides(s)
+	s.mu.RUnlock()
+	staged.automaticEnv(s.envPrefix)
+	if err := staged.useFiles(files); err != nil {
+		return nil, err
+	}
+	return staged, nil
+}
+
+// Replaces the config files and sources with the staged ones. Values set since staging are kept.
+func (s *configStore) swap(staged *configStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	staged.copyOverrides(s)
+	s.Viper = staged.Viper
+	s.files = staged.files
+	s.sources = staged.sources
+}
+
+// The caller holds the locks.
+func (s *configStore) copyOverrides(from *configStore) {
+	for confKey := range from.overrides {
+		s.overrides[confKey] = true
+		s.Set(confKey, from.Get(confKey))
+	}
+}
+
+// Replaces the config file layer with the files merged in order. Other layers are not changed.
+// Keys missing from a command section are inherited from the parent sections.
+func (s *configStore) useFiles(files configFiles) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Clears the values of the previous files
+	s.SetConfigType("toml")
+	if err := s.ReadConfig(bytes.NewReader(nil)); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := s.MergeConfigMap(file.values.AllSettings()); err != nil {
+			return err
+		}
+	}
+	inherited := make(map[string]interface{})
+	for _, k := range s.keys {
+		if fileKey, file := files.find(k, s.profile); fileKey != "" && fileKey != k.confKey {
+			setPath(inherited, strings.Split(k.confKey, "."), file.values.Get(fileKey))
+		}
+		// .env files override the other files like env variables do
+		if file := files.findEnv(k); file != nil {
+			setPath(inherited, strings.Split(k.confKey, "."), file.env[k.envKey])
+		}
+		// `_FILE` env variables override the .env files, the variable itself still overrides them
+		secret, ok, err := secretFromFile(k)
+		if err != nil {
+			return err
+		}
+		if ok {
+			setPath(inherited, strings.Split(k.confKey, "."), secret)
+		}
+	}
+	if err := s.MergeConfigMap(inherited); err != nil {
+		return err
+	}
+	s.files = files
+	return nil
+}
+
+func setPath(m map[string]interface{}, path []string, value interface{}) {
+	sectionMap(m, path[:len(path)-1])[path[len(path)-1]] = value
+}
+
+func (s *configStore) get(confKey string) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value(confKey)
+}
+
+// Viper holds every layer but the config sources in the default order. The caller holds the lock.
+func (s *configStore) value(confKey string) interface{} {
+	k := s.index[confKey]
+	if k == nil || (len(s.sources) == 0 && s.order == nil) {
+		return s.Get(confKey)
+	}
+	source, fileKey, file := s.find(k)
+	switch {
+	case file != nil:
+		return file.values.Get(fileKey)
+	case source.Layer == LayerEnv && s.order != nil:
+		// Viper prefers a changed flag
+		return s.envValue(k, source)
+	}
+	return s.Get(confKey)
+}
+
+func (s *configStore) envValue(k *boundKey, source Source) interface{} {
+	switch source.Name {
+	case k.envKey:
+		return os.Getenv(k.envKey)
+	case k.envKey + secretFileSuffix:
+		if secret, ok, err := secretFromFile(k); err == nil && ok {
+			return secret
+		}
+	}
+	if file := s.files.findEnv(k); file != nil {
+		return file.env[k.envKey]
+	}
+	return s.Get(k.confKey)
+}
+
+// Values of sensitive keys are redacted
+func (s *configStore) allSettings() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	settings := s.AllSettings()
+	if len(s.sources) > 0 || s.order != nil {
+		for _, k := range s.keys {
+			setPath(settings, strings.Split(k.confKey, "."), s.value(k.confKey))
+		}
+	}
+	s.redactSettings(settings)
+	return settings
+}
+
+func (s *configStore) set(confKey string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overrides[confKey] = true
+	s.Set(confKey, value)
+}
+
+// Follows the precedence used by viper: set, flag, env, file, default, unless it's reordered with `Precedence`.
+// Config sources are placed above their layer.
+func (s *configStore) source(k *boundKey) Source {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	source, _, _ := s.find(k)
+	return source
+}
+
+// Returns the source of the value. For config sources and files also the path of the value and its values.
+// The caller holds the lock.
+func (s *configStore) find(k *boundKey) (Source, string, *configFile) {
+	for _, layer := range s.layers() {
+		if source, fileKey, file := s.findInSources(k, layer); file != nil {
+			return source, fileKey, file
+		}
+		if source, fileKey, file := s.findInLayer(k, layer); source.Layer != "" {
+			return source, fileKey, file
+		}
+	}
+	return Source{Layer: LayerDefault}, "", nil
+}
+
+// The layer is empty if it doesn't set the key
+func (s *configStore) findInLayer(k *boundKey, layer Layer) (Source, string, *configFile) {
+	switch layer {
+	case LayerSet:
+		if s.overrides[k.confKey] {
+			return Source{Layer: LayerSet}, "", nil
+		}
+	case LayerFlag:
+		if k.flag != nil && k.flag.Changed {
+			return Source{Layer: LayerFlag, Name: "--" + k.flag.Name}, "", nil
+		}
+	case LayerEnv:
+		switch {
+		case os.Getenv(k.envKey) != "":
+			return Source{Layer: LayerEnv, Name: k.envKey}, "", nil
+		case os.Getenv(k.envKey+secretFileSuffix) != "":
+			return Source{Layer: LayerEnv, Name: k.envKey + secretFileSuffix}, "", nil
+		}
+		if file := s.files.findEnv(k); file != nil {
+			return Source{Layer: LayerEnv, Name: file.name, Line: file.envLines[k.envKey]}, "", nil
+		}
+	case LayerFile:
+		if fileKey, file := s.files.find(k, s.profile); file != nil {
+			return Source{Layer: LayerFile, Name: file.name, Line: file.line(fileKey)}, fileKey, file
+		}
+	case LayerDefault:
+		return Source{Layer: LayerDefault}, "", nil
+	}
+	return Source{}, "", nil
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type grpcConf struct {
+	Port       int           `pungi:"port" desc:"gRPC service listen port."`
+	DbUri      string        `pungi:"dbUri" desc:"DB Uri"`
+	Timeout    time.Duration `desc:"Request timeout"`
+	Origins    []string      `pungi:"origins"`
+	Level      logLevel      `pungi:"level"`
+	CpuProfile bool          `pungi:"-"`
+	internal   string
+}
+
+type rootConf struct {
+	CpuProfile bool `pungi:"cpuprofile" desc:"Starts CPU profiler if set to true."`
+}
+
+func TestKeysFromAndBind(t *testing.T) {
+	defer os.Unsetenv("BINDAPP_GRPC_DBURI")
+	os.Setenv("BINDAPP_GRPC_DBURI", "inmemory")
+
+	var bound grpcConf
+	var boundRoot rootConf
+	p, err := pungi.New("bindapp", "Music store web application").
+		KeysFrom(rootConf{CpuProfile: true}).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", func(conf *pungi.Conf, args []string) error {
+			if err := conf.Bind(&boundRoot); err != nil {
+				return err
+			}
+			return conf.Bind(&bound)
+		}).KeysFrom(&grpcConf{
+			Port:    5432,
+			DbUri:   "boltdb:db/my.db",
+			Timeout: time.Second,
+			Origins: []string{"a.com"},
+			Level:   "info",
+		})).
+		Initialize()
+	require.NoError(t, err)
+
+	require.NoError(t, p.Execute("grpc", "--port=6000", "--level=debug"))
+
+	assert.Equal(t, grpcConf{
+		Port:    6000,
+		DbUri:   "inmemory",
+		Timeout: time.Second,
+		Origins: []string{"a.com"},
+		Level:   "debug",
+	}, bound)
+	assert.True(t, boundRoot.CpuProfile)
+	assert.Equal(t, time.Second, p.Config("grpc").GetDuration("timeout"))
+}
+
+func TestKeysFromRejectsNonStruct(t *testing.T) {
+	p, err := pungi.New("bindapp", "Music store web application").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).KeysFrom(42)).
+		Initialize()
+	require.Error(t, err)
+	require.Nil(t, p)
+}
+
+func TestBindRejectsNonPointer(t *testing.T) {
+	conf := pungi.NewConf("bindapp", "")
+	require.Error(t, conf.Bind(rootConf{}))
+}
+
+func TestBindReportsMistakes(t *testing.T) {
+	type misspelled struct {
+		Port int `pungi:"prot"`
+	}
+	type portConf struct {
+		Port int `pungi:"port"`
+	}
+	p, err := pungi.New("bindmistakes", "Music store web application").
+		Key("port", 5432, "Service listen port.").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute())
+
+	var bound misspelled
+	err = p.RootConfig().Bind(&bound)
+	assert.EqualError(t, err, "field Port: Key prot is not declared, did you mean port?")
+	assert.IsType(t, &pungi.UndeclaredKeyError{}, errors.Cause(err))
+
+	defer os.Unsetenv("BINDMISTAKES_PORT")
+	os.Setenv("BINDMISTAKES_PORT", "abc")
+	var port portConf
+	err = p.RootConfig().Bind(&port)
+	assert.EqualError(t, err, `field Port: Key port: invalid int value "abc" (from env BINDMISTAKES_PORT)`)
+}
@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigShow(t *testing.T) {
+	defer os.Unsetenv("CFGSHOW_GRPC_PORT")
+	os.Setenv("CFGSHOW_GRPC_PORT", "6000")
+	p, err := pungi.New("cfgshow", "Music store web application").
+		ConfigCommand().
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", func(conf *pungi.Conf, args []string) error {
+			t.Fatal("Runnable must not be called")
+			return nil
+		}).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri"),
+		).
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc).
+			Key("port", 8080, "Http GW listen port."),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	out, err := captureStdout(func() error { return p.Execute("config", "show") })
+	require.NoError(t, err)
+	assert.Contains(t, out, "[cfgshow.grpc]")
+	assert.Contains(t, out, "[cfgshow.httpgw]")
+	assert.Contains(t, out, "port = 6000")
+	assert.Contains(t, out, `dbUri = "boltdb:db/my.db"`)
+
+	out, err = captureStdout(func() error { return p.Execute("config", "show", "grpc", "--format=json") })
+	require.NoError(t, err)
+	var values map[string]map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &values))
+	assert.Equal(t, float64(6000), values["cfgshow"]["grpc"]["port"])
+	assert.Equal(t, false, values["cfgshow"]["grpc"]["cpuprofile"])
+	assert.NotContains(t, values["cfgshow"], "httpgw")
+
+	out, err = captureStdout(func() error { return p.Execute("config", "show", "httpgw", "--format=yaml") })
+	require.NoError(t, err)
+	assert.Contains(t, out, "httpgw:\n    cpuprofile: false\n    port: 8080")
+}
+
+func TestConfigGet(t *testing.T) {
+	p, err := pungi.New("cfgget", "Music store web application").
+		ConfigCommand().
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri"),
+		).
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", func(conf *pungi.Conf, args []string) error {
+			t.Fatal("Runnable must not be called")
+			return nil
+		}).
+			Key("port", 8080, "Http GW listen port."),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	out, err := captureStdout(func() error { return p.Execute("config", "get", "httpgw", "port") })
+	require.NoError(t, err)
+	assert.Equal(t, "8080\n", out)
+
+	_, err = captureStdout(func() error { return p.Execute("config", "get", "httpgw", "dbUri") })
+	require.Error(t, err)
+	_, err = captureStdout(func() error { return p.Execute("config", "get", "unknown", "port") })
+	require.Error(t, err)
+}
+
+func TestConfigGetAppKey(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", `
+[cfggetapp]
+cpuprofile = true
+
+[cfggetapp.grpc]
+cpuprofile = false
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+	p, err := pungi.New("cfggetapp", "Music store web application").
+		ConfigCommand().
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port."),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	out, err := captureStdout(func() error { return p.Execute("config", "get", "cpuprofile", "--config="+file) })
+	require.NoError(t, err)
+	assert.Equal(t, "true\n", out, "Without a command the app section is used")
+
+	out, err = captureStdout(func() error { return p.Execute("config", "get", "grpc", "cpuprofile", "--config="+file) })
+	require.NoError(t, err)
+	assert.Equal(t, "false\n", out)
+
+	_, err = captureStdout(func() error { return p.Execute("config", "get", "port", "--config="+file) })
+	assert.EqualError(t, err, "Unknown app key: port, give the command name for command keys")
+}
+
+func TestConfigExplain(t *testing.T) {
+	p, err := pungi.New("cfgexplain", "Music store web application").
+		ConfigCommand().
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port."),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	out, err := captureStdout(func() error {
+		return p.Execute("config", "explain", "grpc", "--config=../testappMultiConfig/config.toml")
+	})
+	require.NoError(t, err)
+	assert.Contains(t, out, "[cfgexplain.grpc]")
+	assert.Regexp(t, `port\s+5432\s+default`, out)
+}
+
+func TestConfigValidate(t *testing.T) {
+	p, err := pungi.New("cfgvalidate", "Music store web application").
+		ConfigCommand().
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.", pungi.Max(65535)),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	out, err := captureStdout(func() error { return p.Execute("config", "validate") })
+	require.NoError(t, err)
+	assert.Equal(t, "Configuration is valid\n", out)
+
+	_, err = captureStdout(func() error { return p.Execute("config", "validate", "--config=../testappMultiConfig/config.toml") })
+	require.NoError(t, err, "Sections of another app are ignored")
+
+	defer os.Unsetenv("CFGVALIDATE_GRPC_PORT")
+	os.Setenv("CFGVALIDATE_GRPC_PORT", "70000")
+	_, err = captureStdout(func() error { return p.Execute("config", "validate") })
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cfgvalidate.grpc.port must be at most 65535")
+}
+
+func TestConfigCommandWithRootArgs(t *testing.T) {
+	var runArgs []string
+	p, err := pungi.New("cfgrootargs", "Music store web application").
+		ConfigCommand().
+		Key("port", 8080, "Listen port").
+		Run(func(_ *pungi.Conf, args []string) error {
+			runArgs = args
+			return nil
+		}).
+		Initialize()
+	require.NoError(t, err)
+
+	require.NoError(t, p.Execute("file.txt"))
+	assert.Equal(t, []string{"file.txt"}, runArgs)
+
+	out, err := captureStdout(func() error { return p.Execute("config", "get", "port") })
+	require.NoError(t, err)
+	assert.Equal(t, "8080\n", out)
+}
+
+func TestConfigCommandNameIsReserved(t *testing.T) {
+	p, err := pungi.New("cfgreserved", "Music store web application").
+		ConfigCommand().
+		Cmd(pungi.Cmd("config", "Configures.", grpcFunc)).
+		Initialize()
+	require.Error(t, err)
+	require.Nil(t, p)
+}
+
+// Runs the function and returns everything written to stdout.
+func captureStdout(run func() error) (string, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	output := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, reader)
+		output <- buf.String()
+	}()
+
+	runErr := run()
+	os.Stdout = stdout
+	_ = writer.Close()
+	return <-output, runErr
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteContextCancelsRunnable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := pungi.New("ctxapp", "Music store web application").
+		Cmd(pungi.CmdContext("grpc", "Starts gRPC service.", func(ctx context.Context, conf *pungi.Conf, args []string) error {
+			cancel()
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(5 * time.Second):
+				return ctx.Err()
+			}
+		})).
+		Initialize()
+	require.NoError(t, err)
+
+	require.NoError(t, p.ExecuteContext(ctx, "grpc"))
+}
+
+func TestContextCancelledOnSignal(t *testing.T) {
+	var runnableErr error
+	p, err := pungi.New("ctxsignal", "Music store web application").
+		ShutdownTimeout(time.Minute).
+		RunContext(func(ctx context.Context, conf *pungi.Conf, args []string) error {
+			process, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				return err
+			}
+			if err := process.Signal(syscall.SIGTERM); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				runnableErr = ctx.Err()
+			case <-time.After(5 * time.Second):
+				t.Error("Context was not cancelled")
+			}
+			return nil
+		}).
+		Initialize()
+	require.NoError(t, err)
+
+	require.NoError(t, p.Execute())
+	assert.Equal(t, context.Canceled, runnableErr)
+	assert.Equal(t, time.Minute, p.RootConfig().GetDuration("shutdownTimeout"))
+}
+
+func TestShutdownTimeoutKey(t *testing.T) {
+	p, err := pungi.New("ctxkey", "Music store web application").
+		Cmd(pungi.CmdContext("grpc", "Starts gRPC service.", func(ctx context.Context, conf *pungi.Conf, args []string) error {
+			return nil
+		})).
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc)).
+		Initialize()
+	require.NoError(t, err)
+
+	assert.Equal(t, 10*time.Second, p.Config("grpc").GetDuration("shutdownTimeout"))
+	assert.Zero(t, p.Config("httpgw").GetDuration("shutdownTimeout"), "Only context aware commands have the key")
+
+	require.NoError(t, p.Execute("grpc", "--shutdownTimeout=3s"))
+	assert.Equal(t, 3*time.Second, p.Config("grpc").GetDuration("shutdownTimeout"))
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"os"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndeclaredKeyE(t *testing.T) {
+	p, err := pungi.New("undeclared", "Music store web application").
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc).
+			Key("grpcUri", "http://localhost:5432", "Grpc service Uri.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("httpgw"))
+
+	conf := p.Config("httpgw")
+	uri, err := conf.GetStringE("grpcUri")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:5432", uri)
+
+	uri, err = conf.GetStringE("grpcuri")
+	require.NoError(t, err, "Keys are case insensitive")
+	assert.Equal(t, "http://localhost:5432", uri)
+
+	profile, err := conf.GetBoolE("cpuprofile")
+	require.NoError(t, err, "Root keys are declared for the commands")
+	assert.False(t, profile)
+
+	uri, err = conf.GetStringE("grpcUrl")
+	assert.Equal(t, "", uri)
+	assert.Equal(t, &pungi.UndeclaredKeyError{Key: "grpcUrl", Command: "httpgw", Suggestion: "grpcUri"}, err)
+	assert.EqualError(t, err, "Key grpcUrl is not declared for command httpgw, did you mean grpcUri?")
+
+	assert.Equal(t, "", conf.GetString("grpcUrl"), "Plain getters don't panic by default")
+}
+
+func TestRootKeysDeclaredWithoutRootRunnable(t *testing.T) {
+	defer os.Unsetenv("UNDECLAREDROOT_LEVEL")
+	os.Setenv("UNDECLAREDROOT_LEVEL", "debug")
+	p, err := pungi.New("undeclaredroot", "Music store web application").
+		Key("cpuprofile", true, "Starts CPU profiler if set to true.").
+		Key("level", "info", "Log level").
+		PanicOnUndeclaredKeys().
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc).
+			Key("grpcUri", "http://localhost:5432", "Grpc service Uri.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("httpgw"))
+
+	conf := p.RootConfig()
+	profile, err := conf.GetBoolE("cpuprofile")
+	require.NoError(t, err)
+	assert.True(t, profile)
+	assert.True(t, conf.GetBool("cpuprofile"), "Plain getters don't panic")
+	assert.Equal(t, "debug", conf.GetString("level"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerEnv, Name: "UNDECLAREDROOT_LEVEL"}, conf.Source("level"))
+
+	_, err = conf.GetStringE("grpcUri")
+	assert.IsType(t, &pungi.UndeclaredKeyError{}, err, "Command keys are not declared for the root")
+}
+
+func TestPanicOnUndeclaredKeys(t *testing.T) {
+	p, err := pungi.New("undeclaredpanic", "Music store web application").
+		Key("port", 8080, "Listen port").
+		PanicOnUndeclaredKeys().
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute())
+
+	conf := p.RootConfig()
+	assert.Equal(t, 8080, conf.GetInt("port"))
+	defer func() {
+		assert.Equal(t, &pungi.UndeclaredKeyError{Key: "prot", Suggestion: "port"}, recover())
+	}()
+	conf.GetInt("prot")
+	t.Error("Expected a panic")
+}
+
+func TestUnreadKeys(t *testing.T) {
+	logger := &recordingLogger{}
+	p, err := pungi.New("unread", "Music store web application").
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Logger(logger).
+		ReportUnreadKeys().
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", func(conf *pungi.Conf, args []string) error {
+			_ = conf.GetInt("port")
+			return nil
+		}).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri", pungi.Required())).
+		Initialize()
+	require.NoError(t, err)
+
+	require.NoError(t, p.Execute("grpc", "--dbUri=inmemory"))
+	assert.Equal(t, []string{"cpuprofile", "dbUri"}, p.Config("grpc").UnreadKeys(),
+		"Validation doesn't count as a read")
+	assert.Equal(t, []string{"Config keys never read in [unread.grpc]: cpuprofile, dbUri"}, logger.lines)
+
+	// Every execution starts over
+	require.NoError(t, p.Execute("grpc", "--dbUri=inmemory"))
+	assert.Equal(t, []string{"cpuprofile", "dbUri"}, p.Config("grpc").UnreadKeys())
+	assert.Len(t, logger.lines, 2)
+
+	_ = p.Config("grpc").GetString("dbUri")
+	assert.Equal(t, []string{"cpuprofile"}, p.Config("grpc").UnreadKeys())
+}
+
+func TestUnreadKeysBind(t *testing.T) {
+	var bound struct {
+		Port  int
+		DbUri string
+	}
+	p, err := pungi.New("unreadbind", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Key("dbUri", "boltdb:db/my.db", "Db Uri").
+		Key("origins", []string{"a.com"}, "Allowed origins").
+		Run(func(conf *pungi.Conf, args []string) error {
+			return conf.Bind(&bound)
+		}).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute())
+	assert.Equal(t, []string{"origins"}, p.RootConfig().UnreadKeys())
+}
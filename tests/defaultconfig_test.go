@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDefaultConfigToml(t *testing.T) {
+	size := byteSize(1024)
+	p, err := pungi.New("definit", "Music store web application").
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri").
+			Key("password", "", "Db password", pungi.Sensitive()).
+			Key("name", "", "Service name", pungi.Required()).
+			Key("timeout", 3*time.Second, "Request timeout").
+			Key("ratio", 2.0, "Ratio").
+			Key("origins", []string{"a.com", "b.com"}, "Allowed origins").
+			Key("labels", map[string]string{"team": "music"}, "Labels").
+			Key("maxSize", &size, "Max upload size"),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, p.WriteDefaultConfig(&buf, "toml"))
+	out := buf.String()
+	assert.Contains(t, out, "[definit]")
+	assert.Contains(t, out, "[definit.grpc]")
+	assert.Contains(t, out, "# Service listen port.\n    port = 5432")
+	assert.Contains(t, out, `dbUri = "boltdb:db/my.db"`)
+	assert.Contains(t, out, "ratio = 2.0")
+	assert.Contains(t, out, "# Service name\n    # name = \"\"")
+
+	// The generated file is read back with the same values
+	file := writeTempConfig(t, "config.toml", out)
+	defer os.RemoveAll(filepath.Dir(file))
+	err = p.Execute("grpc", "--config="+file)
+	require.IsType(t, &pungi.ValidationError{}, err, "Required keys are not set by the file")
+	assert.Equal(t, "name", err.(*pungi.ValidationError).Violations[0].Key)
+
+	defer os.Unsetenv("DEFINIT_GRPC_NAME")
+	os.Setenv("DEFINIT_GRPC_NAME", "grpc")
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	conf := p.Config("grpc")
+	for _, key := range []string{"cpuprofile", "port", "dbUri", "timeout", "ratio", "origins", "labels", "maxSize"} {
+		assert.Equal(t, pungi.LayerFile, conf.Source(key).Layer, key)
+	}
+	assert.Equal(t, pungi.LayerDefault, conf.Source("password").Layer, "Sensitive keys are not pinned")
+	assert.Equal(t, pungi.LayerEnv, conf.Source("name").Layer, "Required keys are not pinned")
+	assert.Equal(t, 3*time.Second, conf.GetDuration("timeout"))
+	assert.Equal(t, []string{"a.com", "b.com"}, conf.GetStringSlice("origins"))
+	assert.Equal(t, map[string]string{"team": "music"}, conf.GetStringMap("labels"))
+	assert.Equal(t, 2.0, conf.GetFloat64("ratio"))
+}
+
+func TestWriteDefaultConfigYaml(t *testing.T) {
+	p, err := pungi.New("defyaml", "Music store web application").
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("origins", []string{"a.com", "b.com"}, "Allowed origins"),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, p.WriteDefaultConfig(&buf, "yaml"))
+	out := buf.String()
+	assert.Contains(t, out, "defyaml:\n  # Starts CPU profiler if set to true.\n  cpuprofile: false\n  grpc:\n")
+	assert.Contains(t, out, "    # Service listen port.\n    port: 5432\n")
+	assert.Contains(t, out, "    origins:\n    - a.com\n    - b.com\n")
+}
+
+func TestWriteDefaultConfigUnknownFormat(t *testing.T) {
+	p, err := pungi.New("defunknown", "Music store web application").
+		Key("port", 5432, "Service listen port.").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.Error(t, p.WriteDefaultConfig(&bytes.Buffer{}, "ini"))
+}
+
+func TestConfigInitCommand(t *testing.T) {
+	p, err := pungi.New("defcmd", "Music store web application").
+		ConfigCommand().
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("timeout", 3*time.Second, "Request timeout"),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	out, err := captureStdout(func() error { return p.Execute("config", "init", "--format=json") })
+	require.NoError(t, err)
+	assert.Contains(t, out, `"port": 5432`)
+	assert.Contains(t, out, `"timeout": "3s"`)
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSearchPathMergesFiles(t *testing.T) {
+	system := writeTempConfig(t, "config.toml", `[discmerge]
+port = 1000
+dbUri = "system"
+
+[discmerge.grpc]
+timeout = "5s"
+`)
+	defer os.RemoveAll(filepath.Dir(system))
+	user := writeTempConfig(t, "config.toml", `[discmerge]
+dbUri = "user"
+`)
+	defer os.RemoveAll(filepath.Dir(user))
+
+	p, err := pungi.New("discmerge", "Music store web application").
+		ConfigSearchPath(system, "/nonexistent/config.toml", user).
+		Key("port", 8080, "Listen port").
+		Key("dbUri", "boltdb:db/my.db", "Db Uri").
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("timeout", "1s", "Timeout")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc"))
+
+	assert.Equal(t, []string{system, user}, p.ConfigFilesUsed())
+	assert.Equal(t, user, p.ConfigFileUsed())
+	conf := p.Config("grpc")
+	assert.Equal(t, 1000, conf.GetInt("port"))
+	assert.Equal(t, "user", conf.GetString("dbUri"))
+	assert.Equal(t, "5s", conf.GetString("timeout"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: system, Line: 2}, conf.Source("port"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: user, Line: 2}, conf.Source("dbUri"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: system, Line: 6}, conf.Source("timeout"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerDefault}, conf.Source("cpuprofile"))
+}
+
+func TestDefaultSearchPathUsesXdgConfigHome(t *testing.T) {
+	configHome, err := ioutil.TempDir("", "pungi-xdg")
+	require.NoError(t, err)
+	defer os.RemoveAll(configHome)
+	require.NoError(t, os.Mkdir(filepath.Join(configHome, "discxdg"), 0700))
+	userFile := filepath.Join(configHome, "discxdg", "config.toml")
+	require.NoError(t, ioutil.WriteFile(userFile, []byte("[discxdg]\nport = 2000\ndbUri = \"user\"\n"), 0600))
+	project := writeTempConfig(t, "config.toml", "[discxdg]\ndbUri = \"project\"\n")
+	defer os.RemoveAll(filepath.Dir(project))
+
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", configHome)
+
+	p, err := pungi.New("discxdg", "Music store web application").
+		DefaultConfigFile(project).
+		Key("port", 8080, "Listen port").
+		Key("dbUri", "boltdb:db/my.db", "Db Uri").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute())
+
+	assert.Equal(t, []string{userFile, project}, p.ConfigFilesUsed())
+	assert.Equal(t, 2000, p.RootConfig().GetInt("port"))
+	assert.Equal(t, "project", p.RootConfig().GetString("dbUri"))
+}
+
+func TestConfigFlagReplacesSearchPath(t *testing.T) {
+	searched := writeTempConfig(t, "config.toml", "[discflag]\nport = 1000\n")
+	defer os.RemoveAll(filepath.Dir(searched))
+	given := writeTempConfig(t, "config.toml", "[discflag]\ndbUri = \"given\"\n")
+	defer os.RemoveAll(filepath.Dir(given))
+
+	p, err := pungi.New("discflag", "Music store web application").
+		ConfigSearchPath(searched).
+		Key("port", 8080, "Listen port").
+		Key("dbUri", "boltdb:db/my.db", "Db Uri").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc)).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+given))
+
+	assert.Equal(t, []string{given}, p.ConfigFilesUsed())
+	assert.Equal(t, 8080, p.Config("grpc").GetInt("port"))
+	assert.Equal(t, "given", p.Config("grpc").GetString("dbUri"))
+}
+
+func TestConfigSearchPathExpandsEnvironmentVariables(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[discenv]\nport = 3000\n")
+	defer os.RemoveAll(filepath.Dir(file))
+	defer os.Unsetenv("DISCENV_DIR")
+	os.Setenv("DISCENV_DIR", filepath.Dir(file))
+
+	p, err := pungi.New("discenv", "Music store web application").
+		ConfigSearchPath("$DISCENV_DIR/"+filepath.Base(file)).
+		Key("port", 8080, "Listen port").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc)).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc"))
+	assert.Equal(t, 3000, p.Config("grpc").GetInt("port"))
+}
+
+func TestInvalidFileInSearchPath(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[discinvalid\nport = ")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("discinvalid", "Music store web application").
+		ConfigSearchPath(file).
+		Key("port", 8080, "Listen port").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc)).
+		Initialize()
+	require.NoError(t, err)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(p.Execute("grpc")))
+}
+
+func TestRepeatedConfigFlag(t *testing.T) {
+	base := writeTempConfig(t, "config.toml", "[discrepeat]\nport = 1000\ndbUri = \"base\"\n")
+	defer os.RemoveAll(filepath.Dir(base))
+	prod := writeTempConfig(t, "config.toml", "[discrepeat]\ndbUri = \"prod\"\n")
+	defer os.RemoveAll(filepath.Dir(prod))
+
+	p, err := pungi.New("discrepeat", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Key("dbUri", "boltdb:db/my.db", "Db Uri").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc)).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+base, "--config", prod))
+
+	assert.Equal(t, []string{base, prod}, p.ConfigFilesUsed())
+	conf := p.Config("grpc")
+	assert.Equal(t, 1000, conf.GetInt("port"))
+	assert.Equal(t, "prod", conf.GetString("dbUri"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: prod, Line: 2}, conf.Source("dbUri"))
+
+	// The flag values of the previous execution are not kept
+	require.NoError(t, p.Execute("grpc", "--config="+prod))
+	assert.Equal(t, []string{prod}, p.ConfigFilesUsed())
+}
+
+func TestConfigEnvironmentVariablePathList(t *testing.T) {
+	base := writeTempConfig(t, "config.toml", "[disclist]\nport = 1000\ndbUri = \"base\"\n")
+	defer os.RemoveAll(filepath.Dir(base))
+	prod := writeTempConfig(t, "config.toml", "[disclist]\ndbUri = \"prod\"\n")
+	defer os.RemoveAll(filepath.Dir(prod))
+	defer os.Unsetenv("DISCLIST_CONFIG")
+	os.Setenv("DISCLIST_CONFIG", base+string(os.PathListSeparator)+prod)
+
+	p, err := pungi.New("disclist", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Key("dbUri", "boltdb:db/my.db", "Db Uri").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc)).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc"))
+
+	assert.Equal(t, []string{base, prod}, p.ConfigFilesUsed())
+	assert.Equal(t, 1000, p.Config("grpc").GetInt("port"))
+	assert.Equal(t, "prod", p.Config("grpc").GetString("dbUri"))
+}
+
+func TestDropInDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pungi-dropin")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "config.toml")
+	dropIns := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(dropIns, 0700))
+	require.NoError(t, ioutil.WriteFile(main, []byte("[discdropin]\nport = 1000\ndbUri = \"main\"\ncpuprofile = true\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dropIns, "20-prod.toml"), []byte("[discdropin]\ndbUri = \"prod\"\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dropIns, "10-base.toml"), []byte("[discdropin]\nport = 2000\ndbUri = \"base\"\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dropIns, "README"), []byte("not a config file"), 0600))
+
+	p, err := pungi.New("discdropin", "Music store web application").
+		ConfigSearchPath(main).
+		Key("port", 8080, "Listen port").
+		Key("dbUri", "boltdb:db/my.db", "Db Uri").
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc)).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--port=3000"))
+
+	assert.Equal(t, []string{main, filepath.Join(dropIns, "10-base.toml"), filepath.Join(dropIns, "20-prod.toml")}, p.ConfigFilesUsed())
+	conf := p.Config("grpc")
+	assert.Equal(t, 3000, conf.GetInt("port"))
+	assert.Equal(t, "prod", conf.GetString("dbUri"))
+	assert.True(t, conf.GetBool("cpuprofile"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: filepath.Join(dropIns, "20-prod.toml"), Line: 2}, conf.Source("dbUri"))
+
+	// New drop-in files are found on reload
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dropIns, "30-local.toml"), []byte("[discdropin]\ncpuprofile = false\n"), 0600))
+	require.NoError(t, p.Reload())
+	assert.False(t, conf.GetBool("cpuprofile"))
+}
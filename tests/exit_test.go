@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCodes(t *testing.T) {
+	ok := func(_ *pungi.Conf, _ []string) error { return nil }
+	failing := func(_ *pungi.Conf, _ []string) error { return errors.New("Port is in use") }
+	custom := func(_ *pungi.Conf, _ []string) error {
+		return errors.Wrap(pungi.WithExitCode(errors.New("Disk is full"), 7), "Could not start")
+	}
+
+	tests := []struct {
+		name     string
+		runnable pungi.Runnable
+		args     []string
+		code     int
+	}{
+		{"success", ok, []string{}, pungi.ExitOK},
+		{"unknown flag", ok, []string{"--unknown"}, pungi.ExitUsage},
+		{"invalid flag value", ok, []string{"--port=abc"}, pungi.ExitUsage},
+		{"too many arguments", ok, []string{"a", "b"}, pungi.ExitUsage},
+		{"missing config file", ok, []string{"--config=/nonexistent/config.toml"}, pungi.ExitConfig},
+		{"invalid key", ok, []string{"--port=70000"}, pungi.ExitConfig},
+		{"runnable error", failing, []string{}, pungi.ExitFailure},
+		{"runnable exit code", custom, []string{}, 7},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := pungi.New("exitapp", "Application with exit codes.").
+				Key("port", 8080, "Listen port", pungi.Max(65535)).
+				Args(cobra.MaximumNArgs(1)).
+				Run(test.runnable).
+				Initialize()
+			require.NoError(t, err)
+			assert.Equal(t, test.code, pungi.ExitCode(p.Execute(test.args...)))
+		})
+	}
+}
+
+func TestExecuteE(t *testing.T) {
+	ran := false
+	builder := pungi.New("exitexec", "Application with exit codes.").
+		Key("port", 8080, "Listen port").
+		Run(func(_ *pungi.Conf, _ []string) error {
+			ran = true
+			return nil
+		})
+	assert.Equal(t, pungi.ExitOK, builder.ExecuteE("--port=1"))
+	assert.True(t, ran)
+
+	invalid := pungi.New("exitinvalid", "Application with an invalid key.").
+		Key("ratio", float32(1), "Not supported type").
+		Run(func(_ *pungi.Conf, _ []string) error { return nil })
+	assert.Equal(t, pungi.ExitFailure, invalid.ExecuteE())
+}
+
+func TestInvalidConfigFileExitCode(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[exitfile\nport = ")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("exitfile", "Application with exit codes.").
+		Key("port", 8080, "Listen port").
+		Run(func(_ *pungi.Conf, _ []string) error { return nil }).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute("--config=" + file)
+	require.Error(t, err)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(err))
+	assert.Contains(t, err.Error(), "Could not load config from "+file)
+}
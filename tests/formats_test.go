@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFileFormats(t *testing.T) {
+	tests := []struct {
+		name, content string
+	}{
+		{"config.yaml", `fmtyaml:
+  port: 1000
+  grpc:
+    dbUri: inline
+    origins: [x.com, y.com]
+`},
+		{"config.json", `{"fmtjson": {"port": 1000, "grpc": {"dbUri": "inline", "origins": ["x.com", "y.com"]}}}`},
+		{"config.hcl", `fmthcl {
+  port = 1000
+  grpc {
+    dbUri = "inline"
+    origins = ["x.com", "y.com"]
+  }
+}
+`},
+		{"config.properties", `fmtproperties.port = 1000
+fmtproperties.grpc.dbUri = inline
+fmtproperties.grpc.origins = x.com,y.com
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			appName := "fmt" + filepath.Ext(test.name)[1:]
+			file := writeTempConfig(t, test.name, test.content)
+			defer os.RemoveAll(filepath.Dir(file))
+
+			p, err := pungi.New(appName, "Music store web application").
+				Key("port", 8080, "Listen port").
+				Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+					Key("dbUri", "boltdb:db/my.db", "Db Uri").
+					Key("origins", []string{"a.com"}, "Allowed origins")).
+				Initialize()
+			require.NoError(t, err)
+			require.NoError(t, p.Execute("grpc", "--config="+file))
+
+			conf := p.Config("grpc")
+			assert.Equal(t, 1000, conf.GetInt("port"))
+			assert.Equal(t, "inline", conf.GetString("dbUri"))
+			assert.Equal(t, []string{"x.com", "y.com"}, conf.GetStringSlice("origins"))
+			assert.Equal(t, pungi.LayerFile, conf.Source("dbUri").Layer)
+			assert.Equal(t, file, conf.Source("dbUri").Name)
+		})
+	}
+}
+
+func TestConfigFormatFlag(t *testing.T) {
+	file := writeTempConfig(t, "config", "fmtflag:\n  port: 1000\n")
+	dir := filepath.Dir(file)
+	defer os.RemoveAll(dir)
+
+	p, err := pungi.New("fmtflag", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(p.Execute("grpc", "--config="+file)))
+
+	require.NoError(t, p.Execute("grpc", "--config="+file, "--config-format=yaml"))
+	assert.Equal(t, 1000, p.Config("grpc").GetInt("port"))
+
+	defer os.Unsetenv("FMTFLAG_CONFIG_FORMAT")
+	os.Setenv("FMTFLAG_CONFIG_FORMAT", "yaml")
+	p, err = pungi.New("fmtflag", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, 1000, p.Config("grpc").GetInt("port"))
+
+	base := filepath.Join(dir, "base.toml")
+	require.NoError(t, ioutil.WriteFile(base, []byte("[fmtflag.grpc]\ndbUri = \"inline\"\n"), 0600))
+	require.NoError(t, p.Execute("grpc", "--config="+base, "--config="+file), "Files with an extension keep their format")
+	assert.Equal(t, "inline", p.Config("grpc").GetString("dbUri"))
+	assert.Equal(t, 1000, p.Config("grpc").GetInt("port"))
+}
+
+func TestDotEnvFile(t *testing.T) {
+	envFile := writeTempConfig(t, ".env", `# Local overrides
+FMTENV_GRPC_PORT=1000
+export FMTENV_GRPC_DBURI="env file"
+FMTENV_GRPC_ORIGINS=x.com,y.com
+`)
+	defer os.RemoveAll(filepath.Dir(envFile))
+	tomlFile := writeTempConfig(t, "config.toml", "[fmtenv]\nport = 2000\n\n[fmtenv.grpc]\ndbUri = \"toml\"\n")
+	defer os.RemoveAll(filepath.Dir(tomlFile))
+	defer os.Unsetenv("FMTENV_GRPC_PORT")
+	os.Setenv("FMTENV_GRPC_PORT", "3000")
+
+	p, err := pungi.New("fmtenv", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri").
+			Key("origins", []string{"a.com"}, "Allowed origins")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+envFile, "--config="+tomlFile))
+
+	conf := p.Config("grpc")
+	assert.Equal(t, 3000, conf.GetInt("port"))
+	assert.Equal(t, "env file", conf.GetString("dbUri"))
+	assert.Equal(t, []string{"x.com", "y.com"}, conf.GetStringSlice("origins"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerEnv, Name: "FMTENV_GRPC_PORT"}, conf.Source("port"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerEnv, Name: envFile, Line: 3}, conf.Source("dbUri"))
+}
+
+func TestInvalidDotEnvFile(t *testing.T) {
+	envFile := writeTempConfig(t, "app.env", "FMTBADENV_PORT\n")
+	defer os.RemoveAll(filepath.Dir(envFile))
+
+	p, err := pungi.New("fmtbadenv", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(p.Execute("grpc", "--config="+envFile)))
+}
@@ -0,0 +1,275 @@
+package tests
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Serves the config with an ETag, counts the unchanged responses
+type configServer struct {
+	mu          sync.Mutex
+	config      string
+	notModified int
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum([]byte(s.config)))
+	if r.Header.Get("If-None-Match") == etag {
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	_, _ = w.Write([]byte(s.config))
+}
+
+func (s *configServer) setConfig(config string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+}
+
+func TestHTTPSource(t *testing.T) {
+	server := &configServer{config: `{"httpsource": {"port": 6000, "grpc": {"dbUri": "inmemory"}}}`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	file := writeTempConfig(t, "config.toml", "[httpsource.grpc]\nport = 7000\ndbUri = \"file\"\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("httpsource", "Music store web application").
+		Logger(&recordingLogger{}).
+		ConfigURL(pungi.NewHTTPSource(""), pungi.LayerFile).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file, "--config-url="+ts.URL))
+	conf := p.Config("grpc")
+	assert.Equal(t, "inmemory", conf.GetString("dbUri"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerSource, Name: ts.URL}, conf.Source("dbUri"))
+	assert.Equal(t, 6000, conf.GetInt("port"), "The source overrides the command section of the file")
+	assert.Equal(t, "inmemory", conf.AllValues()["dburi"])
+
+	defer os.Unsetenv("HTTPSOURCE_GRPC_DBURI")
+	os.Setenv("HTTPSOURCE_GRPC_DBURI", "env")
+	assert.Equal(t, "env", conf.GetString("dbUri"), "Env variables override the source")
+
+	require.NoError(t, p.Execute("grpc", "--config="+file, "--config-url="+ts.URL))
+	assert.Equal(t, 1, server.notModified, "The ETag is sent")
+}
+
+func TestHTTPSourcePrecedence(t *testing.T) {
+	server := &configServer{config: `{"httpprecedence": {"grpc": {"port": 6000, "dbUri": "inmemory"}}}`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	file := writeTempConfig(t, "config.toml", "[httpprecedence.grpc]\ndbUri = \"file\"\n")
+	defer os.RemoveAll(filepath.Dir(file))
+	defer os.Unsetenv("HTTPPRECEDENCE_GRPC_PORT")
+	os.Setenv("HTTPPRECEDENCE_GRPC_PORT", "7000")
+
+	p, err := pungi.New("httpprecedence", "Music store web application").
+		Logger(&recordingLogger{}).
+		ConfigURL(pungi.NewHTTPSource(ts.URL), pungi.LayerDefault).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, "file", p.Config("grpc").GetString("dbUri"))
+	assert.Equal(t, 7000, p.Config("grpc").GetInt("port"))
+
+	p, err = pungi.New("httpprecedence", "Music store web application").
+		Logger(&recordingLogger{}).
+		ConfigURL(pungi.NewHTTPSource(ts.URL), pungi.LayerEnv).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, 6000, p.Config("grpc").GetInt("port"))
+	require.NoError(t, p.Execute("grpc", "--config="+file, "--port=8000"))
+	assert.Equal(t, 8000, p.Config("grpc").GetInt("port"), "Flags override the source")
+
+	_, err = pungi.New("httpprecedence", "Music store web application").
+		ConfigSource(pungi.NewHTTPSource(ts.URL), pungi.LayerSet).
+		Initialize()
+	assert.EqualError(t, err, fmt.Sprintf(`Config source %s can't be placed above the "set" layer`, ts.URL))
+}
+
+func TestHTTPSourceCache(t *testing.T) {
+	server := &configServer{config: `{"httpcache": {"grpc": {"dbUri": "inmemory"}}}`}
+	ts := httptest.NewServer(server)
+	dir, err := ioutil.TempDir("", "pungi-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cacheFile := filepath.Join(dir, "cache", "config.json")
+	defer os.Unsetenv("HTTPCACHE_CONFIG_URL")
+	os.Setenv("HTTPCACHE_CONFIG_URL", ts.URL)
+
+	p, err := pungi.New("httpcache", "Music store web application").
+		Logger(&recordingLogger{}).
+		ConfigURL(pungi.NewHTTPSource("").Cache(cacheFile), pungi.LayerFile).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc"))
+	assert.Equal(t, "inmemory", p.Config("grpc").GetString("dbUri"))
+	ts.Close()
+
+	logger := &recordingLogger{}
+	p, err = pungi.New("httpcache", "Music store web application").
+		Logger(logger).
+		ConfigURL(pungi.NewHTTPSource("").Cache(cacheFile), pungi.LayerFile).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc"), "The cached config is used offline")
+	assert.Equal(t, "inmemory", p.Config("grpc").GetString("dbUri"))
+	require.Len(t, logger.lines, 2)
+	assert.Contains(t, logger.lines[0], "Warning: config source "+ts.URL)
+
+	p, err = pungi.New("httpcache", "Music store web application").
+		Logger(logger).
+		ConfigURL(pungi.NewHTTPSource(""), pungi.LayerFile).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute("grpc")
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(err), "Without a cache the source must load")
+}
+
+func TestHTTPSourcePolling(t *testing.T) {
+	server := &configServer{config: `{"httppoll": {"grpc": {"port": 6000}}}`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	changed := make(chan interface{}, 1)
+	p, err := pungi.New("httppoll", "Music store web application").
+		Logger(&recordingLogger{}).
+		WatchConfig().
+		ConfigSource(pungi.NewHTTPSource(ts.URL).PollInterval(10*time.Millisecond), pungi.LayerFile).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", func(conf *pungi.Conf, args []string) error {
+			conf.OnChange("port", func(old, new interface{}) {
+				changed <- new
+			})
+			server.setConfig(`{"httppoll": {"grpc": {"port": 7000}}}`)
+			select {
+			case <-changed:
+			case <-time.After(5 * time.Second):
+				t.Error("The change was not noticed")
+			}
+			return nil
+		}).
+			Key("port", 5432, "Service listen port.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc"))
+	assert.Equal(t, 7000, p.Config("grpc").GetInt("port"))
+}
+
+func TestHTTPSourcePollingWithoutCache(t *testing.T) {
+	server := &configServer{config: `{"httpnocache": {"grpc": {"port": 6000}}}`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	notDir := writeTempConfig(t, "config.toml", "")
+	defer os.RemoveAll(filepath.Dir(notDir))
+
+	logger := &recordingLogger{}
+	changed := make(chan interface{}, 1)
+	p, err := pungi.New("httpnocache", "Music store web application").
+		Logger(logger).
+		WatchConfig().
+		ConfigSource(pungi.NewHTTPSource(ts.URL).Cache(filepath.Join(notDir, "config.json")).PollInterval(10*time.Millisecond), pungi.LayerFile).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", func(conf *pungi.Conf, args []string) error {
+			// Nothing is logged by the watcher before the config changes
+			assert.Contains(t, logger.lines[0], "Warning: config source "+ts.URL+": Could not write cache")
+			conf.OnChange("port", func(old, new interface{}) {
+				changed <- new
+			})
+			server.setConfig(`{"httpnocache": {"grpc": {"port": 7000}}}`)
+			select {
+			case <-changed:
+			case <-time.After(5 * time.Second):
+				t.Error("The change was not applied")
+			}
+			return nil
+		}).
+			Key("port", 5432, "Service listen port.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc"), "Cache write failures are warnings")
+	assert.Equal(t, 7000, p.Config("grpc").GetInt("port"))
+}
+
+func TestConfigURLDisabledWithoutURL(t *testing.T) {
+	p, err := pungi.New("httpdisabled", "Music store web application").
+		ConfigURL(pungi.NewHTTPSource(""), pungi.LayerFile).
+		ConfigSource(pungi.MapSource("", map[string]interface{}{"httpdisabled": map[string]interface{}{"port": 6000}}), pungi.LayerFile).
+		Key("port", 5432, "Service listen port.").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute(), "Without a URL the source is not loaded")
+	assert.Equal(t, 6000, p.RootConfig().GetInt("port"), "Sources without a name are loaded")
+}
+
+func TestConfigURLIsResetBetweenRuns(t *testing.T) {
+	server := &configServer{config: `{"httpreset": {"port": 6000}}`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	p, err := pungi.New("httpreset", "Music store web application").
+		ConfigURL(pungi.NewHTTPSource(""), pungi.LayerFile).
+		Key("port", 5432, "Service listen port.").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config-url="+ts.URL))
+	assert.Equal(t, 6000, p.RootConfig().GetInt("port"))
+
+	// Without arguments Execute reuses the previous ones
+	require.NoError(t, p.Execute("--verbosity=1"))
+	assert.Equal(t, 5432, p.RootConfig().GetInt("port"), "The URL of the previous run is not used")
+
+	defer os.Unsetenv("HTTPRESET_CONFIG_URL")
+	os.Setenv("HTTPRESET_CONFIG_URL", ts.URL)
+	require.NoError(t, p.Execute("--verbosity=1"))
+	assert.Equal(t, 6000, p.RootConfig().GetInt("port"), "The env variable is read when the flag is not given")
+}
+
+func TestHTTPSourceSizeLimit(t *testing.T) {
+	large := fmt.Sprintf(`{"httplarge": {"port": 6000, "name": "%s"}}`, strings.Repeat("x", 1<<20))
+	ts := httptest.NewServer(&configServer{config: large})
+	defer ts.Close()
+
+	p, err := pungi.New("httplarge", "Music store web application").
+		ConfigURL(pungi.NewHTTPSource(ts.URL), pungi.LayerFile).
+		Key("port", 5432, "Service listen port.").
+		Key("name", "web", "Service name").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute()
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(err))
+	assert.Contains(t, err.Error(), fmt.Sprintf("%s returned more than 1048576 bytes", ts.URL))
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolation(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[interpolate.grpc]\nport = 6000\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("interpolate", "Music store web application").
+		Interpolate().
+		Key("host", "${INTERPOLATE_HOST:-localhost}", "Host name").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.")).
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc).
+			Key("port", 8080, "Http GW listen port.").
+			Key("grpcUri", "http://${interpolate.host}:${interpolate.grpc.port}", "Grpc service Uri.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("httpgw", "--config="+file))
+	conf := p.Config("httpgw")
+	assert.Equal(t, "http://localhost:6000", conf.GetString("grpcUri"))
+
+	defer os.Unsetenv("INTERPOLATE_HOST")
+	os.Setenv("INTERPOLATE_HOST", "grpc.local")
+	assert.Equal(t, "http://grpc.local:6000", conf.GetString("grpcUri"), "References are expanded on read")
+
+	require.NoError(t, p.Execute("httpgw", "--config="+file, "--grpcUri=${interpolate.httpgw.port}"))
+	assert.Equal(t, 8080, conf.GetInt("grpcUri"), "Values from any layer are expanded")
+}
+
+func TestInterpolationErrors(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", `[interpolateerr]
+host = "${interpolateerr.httpgw.grpcuri}"
+
+[interpolateerr.grpc]
+dbUri = "${interpolateerr.grpc.prot}"
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("interpolateerr", "Music store web application").
+		Interpolate().
+		Key("host", "localhost", "Host name").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc).
+			Key("grpcUri", "http://${interpolateerr.host}:${interpolateerr.grpc.port}", "Grpc service Uri.")).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute("httpgw", "--config="+file)
+	require.Error(t, err)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(err))
+	assert.Contains(t, err.Error(), "interpolateerr.httpgw.grpcuri interpolation cycle interpolateerr.httpgw.grpcuri -> interpolateerr.host -> interpolateerr.httpgw.grpcuri")
+
+	_, err = p.Config("httpgw").GetStringE("grpcUri")
+	assert.Equal(t, &pungi.InterpolationError{
+		Key:   "interpolateerr.httpgw.grpcuri",
+		Cycle: []string{"interpolateerr.httpgw.grpcuri", "interpolateerr.host", "interpolateerr.httpgw.grpcuri"},
+	}, err)
+
+	_, err = p.Config("grpc").GetStringE("dbUri")
+	assert.EqualError(t, err, "Key interpolateerr.grpc.dburi: unknown key in ${interpolateerr.grpc.prot}")
+	assert.Equal(t, "${interpolateerr.grpc.prot}", p.Config("grpc").GetString("dbUri"), "Plain getters keep the reference")
+}
+
+func TestInterpolationIsOptIn(t *testing.T) {
+	p, err := pungi.New("nointerpolate", "Music store web application").
+		Key("host", "${HOSTNAME}", "Host name").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute())
+	assert.Equal(t, "${HOSTNAME}", p.RootConfig().GetString("host"))
+}
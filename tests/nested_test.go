@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNestedCommandInheritsKeys(t *testing.T) {
+	var migrated []string
+	p, err := pungi.New("nestedkeys", "Music store web application").
+		Key("verbose", false, "Verbose output").
+		Cmd(pungi.Cmd("db", "Database commands.", nil).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri").
+			Key("timeout", "1s", "Db timeout").
+			Cmd(pungi.Cmd("migrate", "Migrates the database.", func(_ *pungi.Conf, args []string) error {
+				migrated = args
+				return nil
+			}).
+				Key("steps", 0, "Number of migrations, 0 runs all")).
+			Cmd(pungi.Cmd("seed", "Seeds the database.", func(_ *pungi.Conf, _ []string) error {
+				return nil
+			}).
+				Key("dataset", "demo", "Dataset name")),
+		).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("db", "migrate", "--steps=2", "--dbUri=postgres://db", "v2"))
+
+	assert.Equal(t, []string{"v2"}, migrated)
+	conf := p.Config("db migrate")
+	require.NotNil(t, conf)
+	assert.Equal(t, 2, conf.GetInt("steps"))
+	assert.Equal(t, "postgres://db", conf.GetString("dbUri"))
+	assert.Equal(t, "1s", conf.GetString("timeout"))
+	assert.False(t, conf.GetBool("verbose"))
+
+	seed := p.Config("db seed")
+	require.NotNil(t, seed)
+	assert.Equal(t, "demo", seed.GetString("dataset"))
+	assert.Equal(t, "boltdb:db/my.db", seed.GetString("dbUri"))
+}
+
+func TestNestedCommandConfigSections(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", `[nestedfile]
+verbose = true
+timeout = "3s"
+
+[nestedfile.db]
+dbUri = "postgres://shared"
+timeout = "2s"
+
+[nestedfile.db.migrate]
+dbUri = "postgres://migrate"
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("nestedfile", "Music store web application").
+		Key("verbose", false, "Verbose output").
+		Cmd(pungi.Cmd("db", "Database commands.", nil).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri").
+			Key("timeout", "1s", "Db timeout").
+			Cmd(pungi.Cmd("migrate", "Migrates the database.", func(_ *pungi.Conf, _ []string) error {
+				return nil
+			})).
+			Cmd(pungi.Cmd("seed", "Seeds the database.", func(_ *pungi.Conf, _ []string) error {
+				return nil
+			})),
+		).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("db", "migrate", "--config="+file))
+
+	migrate := p.Config("db migrate")
+	assert.Equal(t, "postgres://migrate", migrate.GetString("dbUri"))
+	assert.Equal(t, "2s", migrate.GetString("timeout"))
+	assert.True(t, migrate.GetBool("verbose"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: file, Line: 10}, migrate.Source("dbUri"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: file, Line: 7}, migrate.Source("timeout"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: file, Line: 2}, migrate.Source("verbose"))
+
+	seed := p.Config("db seed")
+	assert.Equal(t, "postgres://shared", seed.GetString("dbUri"))
+	assert.Equal(t, "2s", seed.GetString("timeout"))
+}
+
+func TestNestedCommandEnvironmentVariables(t *testing.T) {
+	defer os.Unsetenv("NESTEDENV_DB_MIGRATE_STEPS")
+	defer os.Unsetenv("NESTEDENV_DB_SEED_DBURI")
+	os.Setenv("NESTEDENV_DB_MIGRATE_STEPS", "5")
+	os.Setenv("NESTEDENV_DB_SEED_DBURI", "postgres://seed")
+
+	p, err := pungi.New("nestedenv", "Music store web application").
+		Cmd(pungi.Cmd("db", "Database commands.", nil).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri").
+			Cmd(pungi.Cmd("migrate", "Migrates the database.", func(_ *pungi.Conf, _ []string) error {
+				return nil
+			}).
+				Key("steps", 0, "Number of migrations, 0 runs all")).
+			Cmd(pungi.Cmd("seed", "Seeds the database.", func(_ *pungi.Conf, _ []string) error {
+				return nil
+			})),
+		).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("db", "migrate"))
+
+	migrate := p.Config("db migrate")
+	assert.Equal(t, 5, migrate.GetInt("steps"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerEnv, Name: "NESTEDENV_DB_MIGRATE_STEPS"}, migrate.Source("steps"))
+	assert.Equal(t, "boltdb:db/my.db", migrate.GetString("dbUri"))
+	assert.Equal(t, "postgres://seed", p.Config("db seed").GetString("dbUri"))
+}
+
+func TestNestedCommandConfigShow(t *testing.T) {
+	p, err := pungi.New("nestedshow", "Music store web application").
+		ConfigCommand().
+		Cmd(pungi.Cmd("db", "Database commands.", nil).
+			Cmd(pungi.Cmd("migrate", "Migrates the database.", func(_ *pungi.Conf, _ []string) error {
+				return nil
+			}).
+				Key("steps", 0, "Number of migrations, 0 runs all")).
+			Cmd(pungi.Cmd("seed", "Seeds the database.", func(_ *pungi.Conf, _ []string) error {
+				return nil
+			}).
+				Key("dataset", "demo", "Dataset name")),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	out, err := captureStdout(func() error { return p.Execute("config", "show", "db", "migrate") })
+	require.NoError(t, err)
+	assert.Contains(t, out, "[nestedshow.db.migrate]")
+	assert.Contains(t, out, "steps = 0")
+
+	out, err = captureStdout(func() error { return p.Execute("config", "get", "db", "seed", "dataset") })
+	require.NoError(t, err)
+	assert.Equal(t, "demo\n", out)
+}
+
+func TestNestedCommandDefaultConfig(t *testing.T) {
+	p, err := pungi.New("nesteddefault", "Music store web application").
+		Key("verbose", false, "Verbose output").
+		Cmd(pungi.Cmd("db", "Database commands.", nil).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri").
+			Key("timeout", "1s", "Db timeout").
+			Cmd(pungi.Cmd("migrate", "Migrates the database.", func(_ *pungi.Conf, _ []string) error {
+				return nil
+			}).
+				Key("steps", 0, "Number of migrations, 0 runs all")).
+			Cmd(pungi.Cmd("seed", "Seeds the database.", func(_ *pungi.Conf, _ []string) error {
+				return nil
+			}).
+				Key("dataset", "demo", "Dataset name")),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, p.WriteDefaultConfig(&buf, "toml"))
+	out := buf.String()
+	// Inherited keys are written only to the section of the command that declared them
+	assert.Regexp(t, `(?s)\[nesteddefault\]\s+# Verbose output\s+verbose = false\s+\[nesteddefault\.db\]`, out)
+	assert.Regexp(t, `(?s)\[nesteddefault\.db\].*dbUri = "boltdb:db/my.db".*\[nesteddefault\.db\.migrate\]`, out)
+	assert.Regexp(t, `(?s)\[nesteddefault\.db\.migrate\]\s+# Number of migrations, 0 runs all\s+steps = 0\s*$`, out[:strings.Index(out, "[nesteddefault.db.seed]")])
+	assert.Equal(t, 1, strings.Count(out, "dbUri ="))
+}
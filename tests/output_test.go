@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestOutputWriters(t *testing.T) {
+	var out, errOut bytes.Buffer
+	p, err := pungi.New("outwriters", "Music store web application").
+		ConfigCommand().
+		Key("port", 8080, "Listen port", pungi.Max(65535)).
+		Output(&out, &errOut).
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+
+	require.NoError(t, p.Execute("config", "get", "port"))
+	assert.Equal(t, "8080\n", out.String())
+
+	out.Reset()
+	require.Error(t, p.Execute("--unknown"))
+	assert.Empty(t, out.String())
+	assert.Contains(t, errOut.String(), "Error: unknown flag: --unknown\nUsage:")
+
+	errOut.Reset()
+	require.Error(t, p.Execute("--port=70000"))
+	assert.Contains(t, errOut.String(), "Error: Invalid configuration:")
+	assert.NotContains(t, errOut.String(), "Usage:")
+
+	out.Reset()
+	require.NoError(t, p.Execute("--help"))
+	assert.Contains(t, out.String(), "--port int")
+}
+
+func TestLogger(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[outlogger]\nport = 1\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	logger := &recordingLogger{}
+	p, err := pungi.New("outlogger", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Logger(logger).
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+	assert.Equal(t, []string{"Using config file: " + file}, logger.lines)
+
+	logger.lines = nil
+	require.NoError(t, p.Execute("--config=", "--verbosity=2"))
+	assert.Contains(t, logger.lines, "Config file not found: config.toml")
+}
+
+func TestQuiet(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[outquiet]\nport = 1\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	logger := &recordingLogger{}
+	p, err := pungi.New("outquiet", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Logger(logger).
+		Quiet().
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+	assert.Empty(t, logger.lines)
+
+	defer os.Unsetenv("OUTQUIET_VERBOSITY")
+	os.Setenv("OUTQUIET_VERBOSITY", "1")
+	require.NoError(t, p.Execute("--config="+file))
+	assert.Equal(t, []string{"Using config file: " + file}, logger.lines)
+
+	os.Setenv("OUTQUIET_VERBOSITY", "loud")
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(p.Execute("--config="+file)))
+}
+
+func TestVerbosityKeyIsReserved(t *testing.T) {
+	_, err := pungi.New("outreserved", "Music store web application").
+		Key("verbosity", 1, "Verbosity").
+		Run(startWebApp).
+		Initialize()
+	require.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Config file with profile sections, `app` is replaced with the app name
+const profileConfig = `[app]
+port = 1000
+
+[app.profiles.prod]
+port = 2000
+cpuprofile = true
+
+[app.grpc]
+dbUri = "dev"
+
+[app.grpc.profiles.prod]
+dbUri = "prod"
+`
+
+func TestProfileSections(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", strings.Replace(profileConfig, "app", "profsections", -1))
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("profsections", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, "", p.ActiveProfile())
+	conf := p.Config("grpc")
+	assert.Equal(t, 1000, conf.GetInt("port"))
+	assert.Equal(t, "dev", conf.GetString("dbUri"))
+	assert.False(t, conf.GetBool("cpuprofile"))
+
+	require.NoError(t, p.Execute("grpc", "--config="+file, "--profile=prod"))
+	assert.Equal(t, "prod", p.ActiveProfile())
+	assert.Equal(t, "prod", conf.ActiveProfile())
+	assert.Equal(t, 2000, conf.GetInt("port"))
+	assert.Equal(t, "prod", conf.GetString("dbUri"))
+	assert.True(t, conf.GetBool("cpuprofile"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: file, Line: 5}, conf.Source("port"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: file, Line: 12}, conf.Source("dbUri"))
+}
+
+func TestProfileEnvironmentVariable(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", strings.Replace(profileConfig, "app", "profenv", -1))
+	defer os.RemoveAll(filepath.Dir(file))
+	defer os.Unsetenv("PROFENV_PROFILE")
+	os.Setenv("PROFENV_PROFILE", "prod")
+
+	p, err := pungi.New("profenv", "Music store web application").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, "prod", p.ActiveProfile())
+	assert.Equal(t, "prod", p.Config("grpc").GetString("dbUri"))
+
+	// The flag overrides the env variable
+	require.NoError(t, p.Execute("grpc", "--config="+file, "--profile=dev"))
+	assert.Equal(t, "dev", p.ActiveProfile())
+	assert.Equal(t, "dev", p.Config("grpc").GetString("dbUri"))
+}
+
+func TestProfileFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pungi-profile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "config.toml")
+	prod := filepath.Join(dir, "config.prod.toml")
+	require.NoError(t, ioutil.WriteFile(base, []byte("[proffile]\nport = 1000\n\n[proffile.grpc]\ndbUri = \"dev\"\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(prod, []byte("[proffile.grpc]\ndbUri = \"prod\"\n"), 0600))
+
+	p, err := pungi.New("proffile", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+base, "--profile=prod"))
+
+	assert.Equal(t, []string{base, prod}, p.ConfigFilesUsed())
+	conf := p.Config("grpc")
+	assert.Equal(t, 1000, conf.GetInt("port"))
+	assert.Equal(t, "prod", conf.GetString("dbUri"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: prod, Line: 2}, conf.Source("dbUri"))
+
+	// Profile without a file uses the base file only
+	require.NoError(t, p.Execute("grpc", "--config="+base, "--profile=test"))
+	assert.Equal(t, []string{base}, p.ConfigFilesUsed())
+	assert.Equal(t, "dev", conf.GetString("dbUri"))
+}
+
+func TestInvalidProfile(t *testing.T) {
+	p, err := pungi.New("profinvalid", "Music store web application").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(p.Execute("grpc", "--profile=../prod")))
+
+	_, err = pungi.New("profreserved", "Music store web application").
+		Key("profile", "dev", "Profile").
+		Run(startWebApp).
+		Initialize()
+	require.Error(t, err)
+}
@@ -1,18 +1,19 @@
 package tests
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/joosep-wm/pungi"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// In separate package, so external API usage could be seen
+// In separate package, so external API usage could be seen.
+// The tests don't call t.Parallel: many of them set env variables, which are shared by the whole process.
 func TestTwoCommandsInit(t *testing.T) {
-	viper.Reset()
 	p, err := pungi.New("musicstore", "Music store web application").
 		DefaultConfigFile("config/mstore.toml").
 		Key("cpuprofile", true, "Starts CPU profiler if set to true.").
@@ -44,7 +45,6 @@ func TestTwoCommandsInit(t *testing.T) {
 }
 
 func TestDefaultCommandInit(t *testing.T) {
-	viper.Reset()
 	p, err := pungi.New("musicstore", "Starts music store web application.").
 		Key("port", 8080, "Listen port").
 		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
@@ -62,7 +62,6 @@ func TestDefaultCommandInit(t *testing.T) {
 }
 
 func TestMainRunnableAndSubcommandsReturnError(t *testing.T) {
-	viper.Reset()
 	p, err := pungi.New("musicstore", "Starts music store web application.").
 		Run(startWebApp).
 		Cmd(pungi.Cmd("grpc", "Starts gRPC service", grpcFunc)).
@@ -73,7 +72,6 @@ func TestMainRunnableAndSubcommandsReturnError(t *testing.T) {
 }
 
 func TestMainRunnableAndSubcommandsWorksWithDefinedArgs(t *testing.T) {
-	viper.Reset()
 
 	defer func() {
 		webAppArgs = []string{}
@@ -102,7 +100,6 @@ func TestMainRunnableAndSubcommandsWorksWithDefinedArgs(t *testing.T) {
 }
 
 func TestInvalidKeyValue(t *testing.T) {
-	viper.Reset()
 	var ohmy struct{}
 	p, err := pungi.New("musicstore", "Starts music store web application.").
 		Key("port", ohmy, "Listen port").
@@ -114,7 +111,6 @@ func TestInvalidKeyValue(t *testing.T) {
 }
 
 func TestFloatKeyValue(t *testing.T) {
-	viper.Reset()
 	p, err := pungi.New("musicstore", "Starts music store web application.").
 		Key("port", float64(2.0), "Listen port").
 		Run(startWebApp).
@@ -125,7 +121,6 @@ func TestFloatKeyValue(t *testing.T) {
 }
 
 func TestOnlyConfigFile(t *testing.T) {
-	viper.Reset()
 	p, err := pungi.NewConfigFileOnly("testapp", "../testappConfig/config.custom.toml")
 	require.NoError(t, err)
 	assert.Equal(t, 9999, p.RootConfig().GetInt("port"))
@@ -134,7 +129,6 @@ func TestOnlyConfigFile(t *testing.T) {
 }
 
 func TestOnlyConfigFileSetupMulti(t *testing.T) {
-	viper.Reset()
 	p, err := pungi.NewConfigFileOnly("testapp", "../testappMultiConfig/config.toml")
 	require.NoError(t, err)
 	assert.Equal(t, 6666, p.Config("httpgw").GetInt("port"))
@@ -142,7 +136,6 @@ func TestOnlyConfigFileSetupMulti(t *testing.T) {
 }
 
 func TestAllValues(t *testing.T) {
-	viper.Reset()
 	p, err := pungi.New("musicstore", "Starts music store web application.").
 		Key("port", 8080, "Listen port").
 		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
@@ -157,7 +150,6 @@ func TestAllValues(t *testing.T) {
 }
 
 func TestUsageText(t *testing.T) {
-	viper.Reset()
 	defer func() {
 		webAppArgs = []string{}
 	}()
@@ -179,7 +171,6 @@ func TestUsageText(t *testing.T) {
 }
 
 func TestUsageTextSubCommand(t *testing.T) {
-	viper.Reset()
 	defer func() {
 		webAppArgs = []string{}
 	}()
@@ -202,8 +193,34 @@ func TestUsageTextSubCommand(t *testing.T) {
 	assert.Equal(t, 8080, p.Config("webapp").GetInt("port"))
 }
 
+func TestInstancesHaveSeparateConfigs(t *testing.T) {
+	first, err := pungi.New("musicstore", "Music store web application").
+		Key("port", 8080, "Listen port").
+		Run(startWebApp).Initialize()
+	require.NoError(t, err)
+
+	second, err := pungi.New("musicstore", "Music store web application").
+		Key("port", 9090, "Listen port").
+		Run(startWebApp).Initialize()
+	require.NoError(t, err)
+
+	first.RootConfig().Set("port", 1234)
+
+	assert.Equal(t, 1234, first.RootConfig().GetInt("port"))
+	assert.Equal(t, 9090, second.RootConfig().GetInt("port"))
+}
+
+func TestNewConfHasOwnStore(t *testing.T) {
+	first := pungi.NewConf("musicstore", "webapp")
+	second := pungi.NewConf("musicstore", "webapp")
+
+	first.Set("port", 1234)
+
+	assert.Equal(t, 1234, first.GetInt("port"))
+	assert.Equal(t, 0, second.GetInt("port"))
+}
+
 func TestTwoCommandsAllValues(t *testing.T) {
-	viper.Reset()
 	p, err := pungi.New("musicstore", "Music store web application").
 		DefaultConfigFile("config/mstore.toml").
 		Key("cpuprofile", true, "Starts CPU profiler if set to true.").
@@ -243,3 +260,12 @@ func grpcFunc(_ *pungi.Conf, args []string) error {
 	grpcArgs = args
 	return nil
 }
+
+// Writes the content into a file of a new temporary directory. The caller removes the directory.
+func writeTempConfig(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "pungi")
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
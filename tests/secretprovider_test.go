@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mapSecrets map[string]string
+
+func (m mapSecrets) Secret(name string) (string, error) {
+	if secret, ok := m[name]; ok {
+		return secret, nil
+	}
+	return "", fmt.Errorf("secret %s not found", name)
+}
+
+func TestSecretProvider(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[secretprovider.grpc]\ndbUri = \"secret://db/uri\"\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("secretprovider", "Music store web application").
+		Secrets(mapSecrets{"db/uri": "inmemory:resolved"}).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri", pungi.Sensitive())).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, "inmemory:resolved", p.Config("grpc").GetString("dbUri"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: file, Line: 2}, p.Config("grpc").Source("dbUri"))
+
+	p, err = pungi.New("secretprovider", "Music store web application").
+		Secrets(mapSecrets{}).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri", pungi.Sensitive())).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute("grpc", "--config="+file)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(err))
+	assert.Contains(t, err.Error(), "Could not resolve secret://db/uri: secret db/uri not found")
+
+	p, err = pungi.New("secretprovider", "Music store web application").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri", pungi.Sensitive())).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute("grpc", "--config="+file)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(err))
+	assert.Contains(t, err.Error(), "no secret provider")
+}
+
+func TestEncryptedFileProvider(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	defer os.Unsetenv("SECRETENC_SECRET_KEY")
+	os.Setenv("SECRETENC_SECRET_KEY", key)
+	secretsFile := writeTempConfig(t, "secrets", "")
+	dir := filepath.Dir(secretsFile)
+	defer os.RemoveAll(dir)
+	provider := pungi.NewEncryptedFileProvider(secretsFile, "SECRETENC_SECRET_KEY", "")
+
+	var out bytes.Buffer
+	p, err := pungi.New("secretenc", "Music store web application").
+		ConfigCommand().
+		Output(&out, &out).
+		Secrets(provider).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri", pungi.Sensitive())).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("config", "encrypt-value", "db/uri", "inmemory:encrypted"))
+	assert.Regexp(t, `^db/uri=[A-Za-z0-9+/=]+\n$`, out.String())
+	assert.NotContains(t, out.String(), "inmemory")
+	require.NoError(t, ioutil.WriteFile(secretsFile, append([]byte("# Secrets\n"), out.Bytes()...), 0600))
+
+	file := filepath.Join(dir, "config.toml")
+	require.NoError(t, ioutil.WriteFile(file, []byte("[secretenc.grpc]\ndbUri = \"secret://db/uri\"\n"), 0600))
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, "inmemory:encrypted", p.Config("grpc").GetString("dbUri"))
+
+	// The key file is used when the env variable is not set
+	os.Unsetenv("SECRETENC_SECRET_KEY")
+	keyFile := filepath.Join(dir, "key")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte(key+"\n"), 0600))
+	fromKeyFile := pungi.NewEncryptedFileProvider(secretsFile, "SECRETENC_SECRET_KEY", keyFile)
+	secret, err := fromKeyFile.Secret("db/uri")
+	require.NoError(t, err)
+	assert.Equal(t, "inmemory:encrypted", secret)
+
+	wrongKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, 32))
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte(wrongKey), 0600))
+	_, err = fromKeyFile.Secret("db/uri")
+	assert.EqualError(t, err, "secret db/uri could not be decrypted, wrong key?")
+
+	_, err = pungi.NewEncryptedFileProvider(secretsFile, "SECRETENC_SECRET_KEY", "").Secret("db/uri")
+	assert.EqualError(t, err, "secret key not set, set SECRETENC_SECRET_KEY")
+}
+
+func TestEncryptValueFromInput(t *testing.T) {
+	defer os.Unsetenv("SECRETINPUT_SECRET_KEY")
+	os.Setenv("SECRETINPUT_SECRET_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	provider := pungi.NewEncryptedFileProvider("secrets", "SECRETINPUT_SECRET_KEY", "")
+
+	var out bytes.Buffer
+	p, err := pungi.New("secretinput", "Music store web application").
+		ConfigCommand().
+		Input(strings.NewReader("inmemory:from-stdin\n")).
+		Output(&out, &out).
+		Secrets(provider).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("config", "encrypt-value", "db/uri"))
+	encrypted := strings.TrimPrefix(strings.TrimSpace(out.String()), "db/uri=")
+	secret, err := provider.Decrypt("db/uri", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "inmemory:from-stdin", secret)
+
+	// The flags of the root command are applied, the config files are not loaded
+	defer os.Unsetenv("SECRETINPUT_VERBOSITY")
+	os.Setenv("SECRETINPUT_VERBOSITY", "loud")
+	err = p.Execute("config", "encrypt-value", "db/uri", "inmemory:1")
+	assert.EqualError(t, err, "Invalid SECRETINPUT_VERBOSITY: loud")
+}
+
+func TestResolvedSecretsAreRedacted(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[secretshow.grpc]\ndbUri = \"secret://db/uri\"\nname = \"grpc\"\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	var out bytes.Buffer
+	p, err := pungi.New("secretshow", "Music store web application").
+		ConfigCommand().
+		Output(&out, &out).
+		Secrets(mapSecrets{"db/uri": "inmemory:hunter2"}).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri", pungi.Regex(`^boltdb:`)).
+			Key("name", "", "Service name")).
+		Initialize()
+	require.NoError(t, err)
+
+	for _, args := range [][]string{{"show", "grpc"}, {"get", "grpc", "dbUri"}, {"explain", "grpc"}} {
+		out.Reset()
+		require.NoError(t, p.Execute(append([]string{"config", "--config=" + file}, args...)...))
+		assert.NotContains(t, out.String(), "hunter2", args)
+		assert.Contains(t, out.String(), "******", args)
+	}
+	conf := p.Config("grpc")
+	assert.Equal(t, "******", conf.AllValues()["dburi"])
+	assert.Equal(t, "grpc", conf.AllValues()["name"], "Other keys are shown")
+	assert.Equal(t, "inmemory:hunter2", conf.GetString("dbUri"), "Getters return the value")
+
+	err = p.Execute("grpc", "--config="+file)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "hunter2")
+
+	require.NoError(t, p.Execute("grpc", "--config="+file, "--dbUri=boltdb:db/other.db"))
+	assert.Equal(t, "boltdb:db/other.db", conf.AllValues()["dburi"], "Values that are not resolved from a reference are shown")
+}
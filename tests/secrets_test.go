@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSensitiveKeyRedaction(t *testing.T) {
+	var out bytes.Buffer
+	p, err := pungi.New("secretredact", "Music store web application").
+		ConfigCommand().
+		Output(&out, &out).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:admin:hunter2@db", "Db Uri", pungi.Sensitive(), pungi.Regex(`^(boltdb|inmemory):`))).
+		Initialize()
+	require.NoError(t, err)
+
+	require.NoError(t, p.Execute("config", "show", "grpc"))
+	assert.Equal(t, "\n[secretredact]\n\n  [secretredact.grpc]\n    dbUri = \"******\"\n    port = 5432\n", out.String())
+
+	out.Reset()
+	require.NoError(t, p.Execute("config", "get", "grpc", "dbUri"))
+	assert.Equal(t, "******\n", out.String())
+
+	out.Reset()
+	require.NoError(t, p.Execute("config", "explain", "grpc"))
+	assert.NotContains(t, out.String(), "hunter2")
+
+	for _, format := range []string{"toml", "json", "yaml"} {
+		out.Reset()
+		require.NoError(t, p.Execute("config", "init", "--format="+format))
+		assert.NotContains(t, out.String(), "hunter2", "Defaults are left out of the starter config")
+		assert.NotContains(t, out.String(), "******")
+	}
+
+	conf := p.Config("grpc")
+	assert.Equal(t, "boltdb:admin:hunter2@db", conf.GetString("dbUri"), "Getters return the value")
+	assert.Equal(t, "******", conf.AllValues()["dburi"])
+
+	err = p.Execute("grpc", "--dbUri=mysql:root:hunter2@db")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "hunter2")
+	assert.Contains(t, err.Error(), `secretredact.grpc.dburi must match ^(boltdb|inmemory):, got "******"`)
+
+	// Help is sticky in cobra, keep it last
+	out.Reset()
+	require.NoError(t, p.Execute("grpc", "--help"))
+	assert.Contains(t, out.String(), `--dbUri string   Db Uri (default "******")`)
+	assert.NotContains(t, out.String(), "hunter2")
+}
+
+func TestStarterConfigLeavesSecretsUnset(t *testing.T) {
+	p, err := pungi.New("secretinit", "Music store web application").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:admin:hunter2@db", "Db Uri", pungi.Sensitive())).
+		Initialize()
+	require.NoError(t, err)
+
+	for _, format := range []string{"toml", "json", "yaml"} {
+		var buf bytes.Buffer
+		require.NoError(t, p.WriteDefaultConfig(&buf, format))
+		if format != "json" {
+			assert.Contains(t, buf.String(), "# dbUri", "Sensitive keys are commented out")
+		}
+		file := writeTempConfig(t, "config."+format, buf.String())
+		defer os.RemoveAll(filepath.Dir(file))
+
+		require.NoError(t, p.Execute("grpc", "--config="+file))
+		conf := p.Config("grpc")
+		assert.Equal(t, pungi.LayerFile, conf.Source("port").Layer, format)
+		assert.Equal(t, pungi.LayerDefault, conf.Source("dbUri").Layer, format)
+		assert.Equal(t, "boltdb:admin:hunter2@db", conf.GetString("dbUri"), format)
+	}
+}
+
+func TestSecretFromFileEnv(t *testing.T) {
+	secretFile := writeTempConfig(t, "db", "inmemory:from-file\n")
+	dir := filepath.Dir(secretFile)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("SECRETENV_GRPC_DBURI_FILE")
+	os.Setenv("SECRETENV_GRPC_DBURI_FILE", secretFile)
+	file := writeTempConfig(t, "config.toml", "[secretenv.grpc]\ndbUri = \"inmemory:from-config\"\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	var out bytes.Buffer
+	p, err := pungi.New("secretenv", "Music store web application").
+		Output(&out, &out).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri", pungi.Sensitive())).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	conf := p.Config("grpc")
+	assert.Equal(t, "inmemory:from-file", conf.GetString("dbUri"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerEnv, Name: "SECRETENV_GRPC_DBURI_FILE"}, conf.Source("dbUri"))
+
+	defer os.Unsetenv("SECRETENV_GRPC_DBURI")
+	os.Setenv("SECRETENV_GRPC_DBURI", "inmemory:from-env")
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, "inmemory:from-env", conf.GetString("dbUri"), "The variable overrides the file")
+
+	os.Setenv("SECRETENV_GRPC_DBURI_FILE", filepath.Join(dir, "missing"))
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(p.Execute("grpc", "--config="+file)))
+}
+
+func TestSecretFileReference(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", `[secretref.grpc]
+dbUri = "@file:secrets/db"
+`)
+	dir := filepath.Dir(file)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "secrets"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secrets", "db"), []byte("inmemory:referenced\n"), 0600))
+
+	var out bytes.Buffer
+	p, err := pungi.New("secretref", "Music store web application").
+		Output(&out, &out).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("dbUri", "boltdb:db/my.db", "Db Uri", pungi.Sensitive())).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, "inmemory:referenced", p.Config("grpc").GetString("dbUri"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: file, Line: 2}, p.Config("grpc").Source("dbUri"))
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "secrets", "db")))
+	err = p.Execute("grpc", "--config="+file)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(err))
+	assert.Contains(t, err.Error(), "Could not resolve @file:secrets/db")
+}
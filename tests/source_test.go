@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceOfEveryLayer(t *testing.T) {
+	defer os.Unsetenv("SOURCEAPP_HTTPGW_GRPCURI")
+	os.Setenv("SOURCEAPP_HTTPGW_GRPCURI", "http://env:5432")
+	file := writeTempConfig(t, "config.toml", `[sourceapp.httpgw]
+port = 6666
+CpuProfile = true
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("sourceapp", "Music store web application").
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc).
+			Key("port", 8080, "Http GW listen port.").
+			Key("grpcUri", "http://localhost:5432", "Grpc service Uri.").
+			Key("timeout", "1s", "Timeout").
+			Key("name", "gw", "Name"),
+		).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("httpgw", "--config="+file, "--timeout=5s"))
+
+	conf := p.Config("httpgw")
+	conf.Set("name", "overridden")
+
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: file, Line: 2}, conf.Source("port"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFile, Name: file, Line: 3}, conf.Source("cpuprofile"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerEnv, Name: "SOURCEAPP_HTTPGW_GRPCURI"}, conf.Source("grpcUri"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerFlag, Name: "--timeout"}, conf.Source("timeout"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerSet}, conf.Source("name"))
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerDefault}, conf.Source("undeclared"))
+	assert.Equal(t, "file "+file+":2", conf.Source("port").String())
+
+	explain := conf.Explain()
+	assert.Regexp(t, `port\s+6666\s+file .*:2`, explain)
+	assert.Regexp(t, `grpcUri\s+http://env:5432\s+env SOURCEAPP_HTTPGW_GRPCURI`, explain)
+	assert.Regexp(t, `timeout\s+5s\s+flag --timeout`, explain)
+	assert.Regexp(t, `name\s+overridden\s+set`, explain)
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Source changed by the test
+type fixtureSource struct {
+	mu      sync.Mutex
+	values  map[string]interface{}
+	changes chan struct{}
+}
+
+func (s *fixtureSource) Name() string {
+	return "fixture"
+}
+
+func (s *fixtureSource) Load() (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values, nil
+}
+
+func (s *fixtureSource) Watch(done <-chan struct{}, changed func(err error)) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.changes:
+			changed(nil)
+		}
+	}
+}
+
+func (s *fixtureSource) set(values map[string]interface{}) {
+	s.mu.Lock()
+	s.values = values
+	s.mu.Unlock()
+	s.changes <- struct{}{}
+}
+
+func TestMapSource(t *testing.T) {
+	p, err := pungi.New("sources", "Music store web application").
+		Logger(&recordingLogger{}).
+		ConfigSource(pungi.MapSource("defaults", map[string]interface{}{
+			"sources": map[string]interface{}{"port": 6000, "grpc": map[string]interface{}{"dbUri": "inmemory"}},
+		}), pungi.LayerDefault).
+		ConfigSource(pungi.MapSource("overrides", map[string]interface{}{
+			"sources": map[string]interface{}{"grpc": map[string]interface{}{"dbUri": "override"}},
+		}), pungi.LayerDefault).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc"))
+	conf := p.Config("grpc")
+	assert.Equal(t, 6000, conf.GetInt("port"))
+	assert.Equal(t, "override", conf.GetString("dbUri"), "Later sources override earlier ones")
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerSource, Name: "overrides"}, conf.Source("dbUri"))
+}
+
+func TestPrecedence(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[sources.grpc]\nport = 7000\n")
+	defer os.RemoveAll(filepath.Dir(file))
+	defer os.Unsetenv("SOURCES_GRPC_PORT")
+	os.Setenv("SOURCES_GRPC_PORT", "6000")
+
+	p, err := pungi.New("sources", "Music store web application").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, 6000, p.Config("grpc").GetInt("port"))
+
+	p, err = pungi.New("sources", "Music store web application").
+		Precedence(pungi.LayerFlag, pungi.LayerFile, pungi.LayerEnv).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	conf := p.Config("grpc")
+	assert.Equal(t, 7000, conf.GetInt("port"), "The file overrides env variables")
+	assert.Equal(t, pungi.LayerFile, conf.Source("port").Layer)
+	assert.Equal(t, int64(7000), conf.AllValues()["port"])
+	defer os.Unsetenv("SOURCES_GRPC_DBURI")
+	os.Setenv("SOURCES_GRPC_DBURI", "env")
+	assert.Equal(t, "env", conf.GetString("dbUri"), "Env variables override defaults")
+	conf.Set("port", 8000)
+	assert.Equal(t, 8000, conf.GetInt("port"), "Set overrides all layers")
+
+	p, err = pungi.New("sources", "Music store web application").
+		Precedence(pungi.LayerEnv, pungi.LayerFlag, pungi.LayerFile).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file, "--port=9000"))
+	assert.Equal(t, 6000, p.Config("grpc").GetInt("port"), "Env variables override flags")
+
+	_, err = pungi.New("sources", "Music store web application").
+		Precedence(pungi.LayerFile, pungi.LayerEnv).
+		Initialize()
+	assert.EqualError(t, err, `Precedence must order the "flag", "env" and "file" layers, got ["file" "env"]`)
+}
+
+func TestSourceWatcher(t *testing.T) {
+	source := &fixtureSource{
+		values:  map[string]interface{}{"sources": map[string]interface{}{"grpc": map[string]interface{}{"port": 6000}}},
+		changes: make(chan struct{}),
+	}
+	changed := make(chan interface{}, 1)
+	p, err := pungi.New("sources", "Music store web application").
+		Logger(&recordingLogger{}).
+		WatchConfig().
+		ConfigSource(source, pungi.LayerEnv).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", func(conf *pungi.Conf, args []string) error {
+			conf.OnChange("port", func(old, new interface{}) {
+				changed <- new
+			})
+			source.set(map[string]interface{}{"sources": map[string]interface{}{"grpc": map[string]interface{}{"port": 7000}}})
+			select {
+			case value := <-changed:
+				assert.Equal(t, 7000, value)
+			case <-time.After(5 * time.Second):
+				t.Error("The change was not noticed")
+			}
+			return nil
+		}).
+			Key("port", 5432, "Service listen port.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc"))
+}
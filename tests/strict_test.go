@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictAcceptsDeclaredKeys(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", `[strictok]
+cpuprofile = true
+port = 1000
+
+[strictok.profiles.prod]
+port = 2000
+
+[strictok.grpc]
+dbUri = "inmemory"
+
+[strictok.grpc.labels]
+team = "store"
+
+[strictok.httpgw.profiles.prod]
+grpcUri = "http://grpc.prod"
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("strictok", "Music store web application").
+		Strict().
+		Logger(&recordingLogger{}).
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri").
+			Key("labels", map[string]string{"team": "music"}, "Labels")).
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc).
+			Key("port", 8080, "Http GW listen port.").
+			Key("grpcUri", "http://localhost:5432", "Grpc service Uri.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config="+file))
+	assert.Equal(t, map[string]string{"team": "store"}, p.Config("grpc").GetStringMap("labels"))
+}
+
+func TestStrictRejectsUnknownKeys(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", `port = 3333
+
+[strictunknown]
+prot = 1000
+
+[strictunknown.httpgw]
+dburi = "inmemory"
+
+[strictunknown.httgw]
+port = 1
+
+[strictunknown.grpc.profiles.prod]
+unused = true
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("strictunknown", "Music store web application").
+		Strict().
+		Logger(&recordingLogger{}).
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri").
+			Key("labels", map[string]string{"team": "music"}, "Labels")).
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc).
+			Key("port", 8080, "Http GW listen port.").
+			Key("grpcUri", "http://localhost:5432", "Grpc service Uri.")).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute("grpc", "--config="+file)
+	require.Error(t, err)
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(err))
+
+	unknownErr, ok := err.(*pungi.UnknownKeysError)
+	require.True(t, ok, "Expected *UnknownKeysError, got %T", err)
+	source := func(line int) pungi.Source {
+		return pungi.Source{Layer: pungi.LayerFile, Name: file, Line: line}
+	}
+	assert.Equal(t, []pungi.UnknownKey{
+		{Path: "port", Source: source(1), Suggestion: "port in [strictunknown.grpc]"},
+		{Path: "strictunknown.grpc.profiles.prod.unused", Source: source(13)},
+		{Path: "strictunknown.httgw", Source: source(9), Suggestion: "httpgw"},
+		{Path: "strictunknown.httpgw.dburi", Source: source(7), Suggestion: "dbUri in [strictunknown.grpc]"},
+		{Path: "strictunknown.prot", Source: source(4), Suggestion: "port"},
+	}, unknownErr.Keys)
+	assert.Contains(t, err.Error(), "strictunknown.prot (file "+file+":4), did you mean port?")
+}
+
+func TestStrictDotEnvFile(t *testing.T) {
+	envFile := writeTempConfig(t, ".env", "STRICTENV_GRPC_PORT=1\nSTRICTENV_GRPC_DBURL=x\nOTHER_APP_KEY=1\n")
+	defer os.RemoveAll(filepath.Dir(envFile))
+
+	p, err := pungi.New("strictenv", "Music store web application").
+		Strict().
+		Logger(&recordingLogger{}).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri")).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute("grpc", "--config="+envFile)
+	require.Error(t, err)
+	assert.Equal(t, []pungi.UnknownKey{{
+		Path:       "STRICTENV_GRPC_DBURL",
+		Source:     pungi.Source{Layer: pungi.LayerEnv, Name: envFile, Line: 2},
+		Suggestion: "STRICTENV_GRPC_DBURI",
+	}}, err.(*pungi.UnknownKeysError).Keys)
+}
+
+func TestStrictWarnOnly(t *testing.T) {
+	logger := &recordingLogger{}
+	p, err := pungi.New("testapp", "Music store web application").
+		StrictWarn().
+		Logger(logger).
+		Key("cpuprofile", false, "Starts CPU profiler if set to true.").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.").
+			Key("dbUri", "boltdb:db/my.db", "Db Uri").
+			Key("labels", map[string]string{"team": "music"}, "Labels")).
+		Cmd(pungi.Cmd("httpgw", "Starts Http GW.", httpgwFunc).
+			Key("port", 8080, "Http GW listen port.").
+			Key("grpcUri", "http://localhost:5432", "Grpc service Uri.")).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("grpc", "--config=../testappConfig/config.toml"))
+
+	require.Len(t, logger.lines, 2)
+	assert.Contains(t, logger.lines[0], "Warning: Unknown config keys:\n  port (file ../testappConfig/config.toml:1), did you mean port in [testapp.grpc]?")
+	assert.Equal(t, 7777, p.Config("grpc").GetInt("port"))
+}
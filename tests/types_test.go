@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedKeyDefaults(t *testing.T) {
+	releaseDate := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	p, err := pungi.New("typeddefaults", "Application with typed keys.").
+		Key("timeout", 5*time.Second, "Request timeout").
+		Key("origins", []string{"a.com", "b.com"}, "Allowed origins").
+		Key("ports", []int{80, 443}, "Listen ports").
+		Key("labels", map[string]string{"team": "music"}, "Labels").
+		Key("released", releaseDate, "Release date").
+		Key("maxSize", int64(1<<40), "Max upload size").
+		Key("workers", uint(4), "Number of workers").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute())
+
+	conf := p.RootConfig()
+	assert.Equal(t, 5*time.Second, conf.GetDuration("timeout"))
+	assert.Equal(t, []string{"a.com", "b.com"}, conf.GetStringSlice("origins"))
+	assert.Equal(t, []int{80, 443}, conf.GetIntSlice("ports"))
+	assert.Equal(t, map[string]string{"team": "music"}, conf.GetStringMap("labels"))
+	assert.True(t, releaseDate.Equal(conf.GetTime("released")))
+	assert.Equal(t, int64(1<<40), conf.GetInt64("maxSize"))
+	assert.Equal(t, uint(4), conf.GetUint("workers"))
+}
+
+func TestTypedKeyFlags(t *testing.T) {
+	p, err := pungi.New("typedflags", "Application with typed keys.").
+		Key("timeout", 5*time.Second, "Request timeout").
+		Key("origins", []string{"a.com", "b.com"}, "Allowed origins").
+		Key("ports", []int{80, 443}, "Listen ports").
+		Key("labels", map[string]string{"team": "music"}, "Labels").
+		Key("released", time.Time{}, "Release date").
+		Key("workers", uint(4), "Number of workers").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute(
+		"--timeout=1m",
+		"--origins=c.com,d.com",
+		"--ports=8080",
+		"--labels=tier=web",
+		"--released=2020-02-03T00:00:00Z",
+		"--workers=8",
+	))
+
+	conf := p.RootConfig()
+	assert.Equal(t, time.Minute, conf.GetDuration("timeout"))
+	assert.Equal(t, []string{"c.com", "d.com"}, conf.GetStringSlice("origins"))
+	assert.Equal(t, []int{8080}, conf.GetIntSlice("ports"))
+	assert.Equal(t, map[string]string{"tier": "web"}, conf.GetStringMap("labels"))
+	assert.Equal(t, 2020, conf.GetTime("released").Year())
+	assert.Equal(t, uint(8), conf.GetUint("workers"))
+}
+
+func TestTypedKeyEnvironmentVariables(t *testing.T) {
+	defer os.Unsetenv("TYPEDENV_TIMEOUT")
+	defer os.Unsetenv("TYPEDENV_ORIGINS")
+	defer os.Unsetenv("TYPEDENV_PORTS")
+	defer os.Unsetenv("TYPEDENV_LABELS")
+	os.Setenv("TYPEDENV_TIMEOUT", "250ms")
+	os.Setenv("TYPEDENV_ORIGINS", "x.com, y.com")
+	os.Setenv("TYPEDENV_PORTS", "1,2,3")
+	os.Setenv("TYPEDENV_LABELS", "team=ops,tier=db")
+
+	p, err := pungi.New("typedenv", "Application with typed keys.").
+		Key("timeout", 5*time.Second, "Request timeout").
+		Key("origins", []string{"a.com", "b.com"}, "Allowed origins").
+		Key("ports", []int{80, 443}, "Listen ports").
+		Key("labels", map[string]string{"team": "music"}, "Labels").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute())
+
+	conf := p.RootConfig()
+	assert.Equal(t, 250*time.Millisecond, conf.GetDuration("timeout"))
+	assert.Equal(t, []string{"x.com", "y.com"}, conf.GetStringSlice("origins"))
+	assert.Equal(t, []int{1, 2, 3}, conf.GetIntSlice("ports"))
+	assert.Equal(t, map[string]string{"team": "ops", "tier": "db"}, conf.GetStringMap("labels"))
+}
+
+func TestTypedKeyConfigFile(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", `
+[typedfile]
+timeout = "2h"
+origins = ["e.com"]
+ports = [21, 22]
+released = 2021-03-04T05:06:07Z
+
+[typedfile.labels]
+team = "store"
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("typedfile", "Application with typed keys.").
+		Key("timeout", 5*time.Second, "Request timeout").
+		Key("origins", []string{"a.com", "b.com"}, "Allowed origins").
+		Key("ports", []int{80, 443}, "Listen ports").
+		Key("labels", map[string]string{"team": "music"}, "Labels").
+		Key("released", time.Time{}, "Release date").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+
+	conf := p.RootConfig()
+	assert.Equal(t, 2*time.Hour, conf.GetDuration("timeout"))
+	assert.Equal(t, []string{"e.com"}, conf.GetStringSlice("origins"))
+	assert.Equal(t, []int{21, 22}, conf.GetIntSlice("ports"))
+	assert.Equal(t, map[string]string{"team": "store"}, conf.GetStringMap("labels"))
+	assert.Equal(t, 2021, conf.GetTime("released").Year())
+}
+
+func TestTypedGetterErrors(t *testing.T) {
+	defer os.Unsetenv("TYPEDERRORS_PORTS")
+	os.Setenv("TYPEDERRORS_PORTS", "80,abc")
+	file := writeTempConfig(t, "config.toml", "[typederrors]\ntimeout = \"soon\"\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("typederrors", "Application with typed keys.").
+		Key("timeout", 5*time.Second, "Request timeout").
+		Key("origins", []string{"a.com", "b.com"}, "Allowed origins").
+		Key("ports", []int{80, 443}, "Listen ports").
+		Key("workers", uint(4), "Number of workers").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute("--config="+file, "--workers=8")
+	require.Error(t, err, "Invalid values fail before the runnable is called")
+	assert.Equal(t, pungi.ExitConfig, pungi.ExitCode(err))
+	violations := err.(*pungi.ValidationError).Violations
+	require.Len(t, violations, 2)
+	assert.Equal(t, `invalid []int value "80,abc"`, violations[0].Message)
+	assert.Equal(t, `invalid time.Duration value "soon"`, violations[1].Message)
+
+	conf := p.RootConfig()
+	ports, err := conf.GetIntSliceE("ports")
+	assert.Nil(t, ports)
+	assert.Equal(t, []int{80, 0}, conf.GetIntSlice("ports"))
+	require.IsType(t, &pungi.ConversionError{}, err)
+	convErr := err.(*pungi.ConversionError)
+	assert.Equal(t, "80,abc", convErr.Value)
+	assert.Equal(t, pungi.Source{Layer: pungi.LayerEnv, Name: "TYPEDERRORS_PORTS"}, convErr.Source)
+	assert.EqualError(t, err, `Key ports: invalid []int value "80,abc" (from env TYPEDERRORS_PORTS)`)
+
+	timeout, err := conf.GetDurationE("timeout")
+	assert.Equal(t, time.Duration(0), timeout)
+	assert.EqualError(t, err, `Key timeout: invalid time.Duration value "soon" (from file `+file+`:2)`)
+
+	workers, err := conf.GetUintE("workers")
+	require.NoError(t, err)
+	assert.Equal(t, uint(8), workers)
+
+	_, err = conf.GetIntE("origins")
+	assert.EqualError(t, err, `Key origins: invalid int value "[a.com b.com]" (from default)`)
+}
+
+func TestTypedZeroTimeDefault(t *testing.T) {
+	p, err := pungi.New("typedzerotime", "Application with typed keys.").
+		ConfigCommand().
+		Key("since", time.Time{}, "Start of the report").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute(), "The default is not parsed from its flag string")
+
+	since, err := p.RootConfig().GetTimeE("since")
+	require.NoError(t, err)
+	assert.True(t, since.IsZero())
+
+	out, err := captureStdout(func() error { return p.Execute("config", "show") })
+	require.NoError(t, err)
+	assert.Contains(t, out, "since = 0001-01-01T00:00:00Z")
+}
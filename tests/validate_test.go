@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidationPasses(t *testing.T) {
+	var called bool
+	p, err := pungi.New("validok", "Music store web application").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", func(conf *pungi.Conf, args []string) error {
+			called = true
+			return nil
+		}).
+			Key("dbUri", "", "DB Uri", pungi.Required(), pungi.Regex(`^(boltdb|inmemory):`)).
+			Key("mode", "fast", "Mode", pungi.OneOf("fast", "safe")),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	require.NoError(t, p.Execute("grpc", "--dbUri=inmemory:1", "--mode=safe"))
+	assert.True(t, called)
+}
+
+func TestValidationRequiredKey(t *testing.T) {
+	var called bool
+	p, err := pungi.New("validrequired", "Music store web application").
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", func(conf *pungi.Conf, args []string) error {
+			called = true
+			return nil
+		}).
+			Key("port", 5432, "gRPC service listen port.", pungi.Min(1), pungi.Max(65535)).
+			Key("dbUri", "", "DB Uri", pungi.Required()),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	err = p.Execute("grpc")
+	require.Error(t, err)
+	assert.False(t, called, "Runnable must not be called")
+
+	validationErr, ok := err.(*pungi.ValidationError)
+	require.True(t, ok)
+	require.Len(t, validationErr.Violations, 1)
+	violation := validationErr.Violations[0]
+	assert.Equal(t, "dbUri", violation.Key)
+	assert.Equal(t, pungi.LayerDefault, violation.Source.Layer)
+	assert.Equal(t, "VALIDREQUIRED_GRPC_DBURI", violation.EnvKey)
+	assert.Contains(t, err.Error(), "validrequired.grpc.dburi is required")
+}
+
+func TestValidationAggregatesViolations(t *testing.T) {
+	defer os.Unsetenv("VALIDALL_GRPC_PORT")
+	os.Setenv("VALIDALL_GRPC_PORT", "70000")
+	file := writeTempConfig(t, "config.toml", `
+[validall.grpc]
+dbUri = "mysql://localhost"
+mode = "slow"
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	var called bool
+	p, err := pungi.New("validall", "Music store web application").
+		Key("timeout", time.Second, "Request timeout", pungi.Min(time.Millisecond)).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", func(conf *pungi.Conf, args []string) error {
+			called = true
+			return nil
+		}).
+			Key("port", 5432, "gRPC service listen port.", pungi.Min(1), pungi.Max(65535)).
+			Key("dbUri", "", "DB Uri", pungi.Required(), pungi.Regex(`^(boltdb|inmemory):`)).
+			Key("mode", "fast", "Mode", pungi.OneOf("fast", "safe")).
+			Key("name", "grpc", "Name", pungi.Check(func(value interface{}) error {
+				if value.(string) == "" {
+					return errors.New("must not be empty")
+				}
+				return nil
+			})),
+		).
+		Initialize()
+	require.NoError(t, err)
+
+	err = p.Execute("grpc", "--config="+file, "--timeout=0s", "--name=")
+	require.Error(t, err)
+	assert.False(t, called)
+
+	validationErr, ok := err.(*pungi.ValidationError)
+	require.True(t, ok)
+	layers := make(map[string]pungi.Layer)
+	for _, v := range validationErr.Violations {
+		layers[v.Key] = v.Source.Layer
+	}
+	assert.Equal(t, map[string]pungi.Layer{
+		"dbUri":   pungi.LayerFile,
+		"mode":    pungi.LayerFile,
+		"name":    pungi.LayerFlag,
+		"port":    pungi.LayerEnv,
+		"timeout": pungi.LayerFlag,
+	}, layers)
+	assert.Contains(t, err.Error(), "validall.grpc.port must be at most 65535, got 70000 (from env VALIDALL_GRPC_PORT; set with --port, VALIDALL_GRPC_PORT or port in [validall.grpc])")
+}
+
+func TestValidationChecksDefaults(t *testing.T) {
+	p, err := pungi.New("validdefaults", "Music store web application").
+		ConfigCommand().
+		Interpolate().
+		Key("level", "${VALIDDEFAULTS_LOG:-verbose}", "Log level", pungi.OneOf("debug", "info")).
+		Cmd(pungi.Cmd("grpc", "Starts gRPC service.", grpcFunc).
+			Key("port", 5432, "Service listen port.")).
+		Initialize()
+	require.NoError(t, err)
+
+	err = p.Execute("grpc")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `validdefaults.grpc.level must be one of [debug, info], got "verbose" (from default; set with --level`)
+
+	_, err = captureStdout(func() error { return p.Execute("config", "validate") })
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `validdefaults.level must be one of [debug, info], got "verbose" (from default; set with VALIDDEFAULTS_LEVEL or level in [validdefaults])`,
+		"Root keys without a root runnable have no flag")
+
+	defer os.Unsetenv("VALIDDEFAULTS_LOG")
+	os.Setenv("VALIDDEFAULTS_LOG", "debug")
+	require.NoError(t, p.Execute("grpc"))
+}
+
+func TestMinMaxKeyTypes(t *testing.T) {
+	_, err := pungi.New("validbounds", "Music store web application").
+		Key("name", "grpc", "Name", pungi.Min(5)).
+		Run(startWebApp).
+		Initialize()
+	assert.EqualError(t, err, "Key name: Min and Max need numeric or time values, got string and int")
+
+	_, err = pungi.New("validbounds", "Music store web application").
+		Key("since", time.Time{}, "Start of the report", pungi.Max(5)).
+		Run(startWebApp).
+		Initialize()
+	require.Error(t, err)
+
+	since := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	p, err := pungi.New("validbounds", "Music store web application").
+		Key("since", since, "Start of the report", pungi.Min(since)).
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--since=2020-01-01T00:00:00Z"))
+	err = p.Execute("--since=2018-01-01T00:00:00Z")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "validbounds.since must be at least 2019-01-01 00:00:00 +0000 UTC")
+}
+
+func TestRequiredFromStructTag(t *testing.T) {
+	type conf struct {
+		DbUri string `pungi:"dbUri,required"`
+	}
+	p, err := pungi.New("validtag", "Music store web application").
+		KeysFrom(conf{}).
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+
+	err = p.Execute()
+	require.IsType(t, &pungi.ValidationError{}, err)
+	violations := err.(*pungi.ValidationError).Violations
+	require.Len(t, violations, 1)
+	assert.Equal(t, "dbUri", violations[0].Key)
+	assert.Equal(t, "is required", violations[0].Message)
+}
@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Byte size with binary suffixes: "512MiB"
+type byteSize int64
+
+var byteSuffixes = []string{"KiB", "MiB", "GiB"}
+
+func (b *byteSize) Set(s string) error {
+	multiplier := int64(1)
+	for i, suffix := range byteSuffixes {
+		if strings.HasSuffix(s, suffix) {
+			multiplier = 1 << (10 * uint(i+1))
+			s = strings.TrimSuffix(s, suffix)
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n * multiplier)
+	return nil
+}
+func (b *byteSize) String() string { return strconv.FormatInt(int64(*b), 10) }
+func (b *byteSize) Type() string   { return "byteSize" }
+
+type urlValue struct{ url.URL }
+
+func (u *urlValue) Set(s string) error {
+	parsed, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	u.URL = *parsed
+	return nil
+}
+func (u *urlValue) Type() string { return "url" }
+
+type logLevel string
+
+func (l *logLevel) Set(s string) error {
+	switch s {
+	case "debug", "info", "error":
+		*l = logLevel(s)
+		return nil
+	}
+	return fmt.Errorf("unknown log level %q", s)
+}
+func (l *logLevel) String() string { return string(*l) }
+func (l *logLevel) Type() string   { return "level" }
+
+func TestCustomValueDefaults(t *testing.T) {
+	size := byteSize(1024)
+	p, err := pungi.New("valuedefaults", "Application with custom typed keys.").
+		Key("maxSize", &size, "Max upload size").
+		Key("upstream", &urlValue{URL: url.URL{Scheme: "http", Host: "localhost"}}, "Upstream url").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute())
+	assert.Equal(t, byteSize(1024), size, "Default value must not be modified")
+
+	var maxSize byteSize
+	require.NoError(t, p.RootConfig().GetValue("maxSize", &maxSize))
+	assert.Equal(t, byteSize(1024), maxSize)
+
+	var upstream urlValue
+	require.NoError(t, p.RootConfig().GetValue("upstream", &upstream))
+	assert.Equal(t, "localhost", upstream.Host)
+}
+
+func TestCustomValueFlagsAndEnv(t *testing.T) {
+	defer os.Unsetenv("VALUEFLAGS_UPSTREAM")
+	os.Setenv("VALUEFLAGS_UPSTREAM", "https://example.com:8443")
+
+	p, err := pungi.New("valueflags", "Application with custom typed keys.").
+		Key("maxSize", new(byteSize), "Max upload size").
+		Key("level", new(logLevel), "Log level").
+		Key("upstream", &urlValue{URL: url.URL{Scheme: "http", Host: "localhost"}}, "Upstream url").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--maxSize=512MiB", "--level=debug"))
+
+	var size byteSize
+	require.NoError(t, p.RootConfig().GetValue("maxSize", &size))
+	assert.Equal(t, byteSize(512<<20), size)
+
+	var level logLevel
+	require.NoError(t, p.RootConfig().GetValue("level", &level))
+	assert.Equal(t, logLevel("debug"), level)
+
+	var upstream urlValue
+	require.NoError(t, p.RootConfig().GetValue("upstream", &upstream))
+	assert.Equal(t, "example.com:8443", upstream.Host)
+}
+
+func TestCustomValueInvalidFlag(t *testing.T) {
+	p, err := pungi.New("valueinvalid", "Application with custom typed keys.").
+		Key("level", new(logLevel), "Log level").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.Error(t, p.Execute("--level=verbose"))
+}
+
+func TestCustomValueConfigFile(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", `
+[valuefile]
+maxSize = 2048
+level = "error"
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("valuefile", "Application with custom typed keys.").
+		Key("maxSize", new(byteSize), "Max upload size").
+		Key("level", new(logLevel), "Log level").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+
+	var size byteSize
+	require.NoError(t, p.RootConfig().GetValue("maxSize", &size))
+	assert.Equal(t, byteSize(2048), size)
+
+	var level logLevel
+	require.NoError(t, p.RootConfig().GetValue("level", &level))
+	assert.Equal(t, logLevel("error"), level)
+}
+
+func TestCustomValueInvalidConfigFileValue(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", `
+[valuebadfile]
+level = "verbose"
+`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("valuebadfile", "Application with custom typed keys.").
+		Key("level", new(logLevel), "Log level").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	err = p.Execute("--config=" + file)
+	require.Error(t, err, "Invalid values are reported before the runnable is called")
+	assert.Contains(t, err.Error(), `valuebadfile.level invalid level value: unknown log level "verbose"`)
+
+	var level logLevel
+	err = p.RootConfig().GetValue("level", &level)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "valuebadfile.level")
+}
+
+// The zero value prints as "<nil>", which doesn't parse back
+type ipValue struct{ net.IP }
+
+func (ip *ipValue) Set(s string) error {
+	parsed := net.ParseIP(s)
+	if parsed == nil {
+		return fmt.Errorf("invalid IP: %s", s)
+	}
+	ip.IP = parsed
+	return nil
+}
+func (ip *ipValue) Type() string { return "ip" }
+
+func TestCustomValueDefaultNotParsed(t *testing.T) {
+	p, err := pungi.New("valuenotparsed", "Application with custom typed keys.").
+		Key("bind", &ipValue{}, "Bind address").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute(), "Unset optional keys are not validated")
+
+	var bind ipValue
+	require.NoError(t, p.RootConfig().GetValue("bind", &bind))
+	assert.Nil(t, bind.IP)
+
+	defer os.Unsetenv("VALUENOTPARSED_BIND")
+	os.Setenv("VALUENOTPARSED_BIND", "localhost")
+	err = p.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "valuenotparsed.bind invalid ip value: invalid IP: localhost")
+}
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/joosep-wm/pungi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[reloadapp]\nlevel = \"info\"\nrate = 10\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("reloadapp", "Music store web application").
+		WatchConfig().
+		Key("level", "info", "Log level", pungi.OneOf("debug", "info", "error")).
+		Key("rate", 10, "Rate limit").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+
+	conf := p.RootConfig()
+	var oldLevel, newLevel interface{}
+	conf.OnChange("level", func(old, new interface{}) {
+		oldLevel, newLevel = old, new
+	})
+	conf.OnChange("rate", func(old, new interface{}) {
+		t.Error("Unchanged key must not be reported")
+	})
+	var changed []string
+	conf.OnConfigChange(func(keys []string) {
+		changed = keys
+	})
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("[reloadapp]\nlevel = \"debug\"\nrate = 10\n"), 0644))
+	require.NoError(t, p.Reload())
+
+	assert.Equal(t, "debug", conf.GetString("level"))
+	assert.Equal(t, "info", oldLevel)
+	assert.Equal(t, "debug", newLevel)
+	assert.Equal(t, []string{"level"}, changed)
+}
+
+func TestReloadKeepsOldConfigOnValidationError(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[reloadbad]\nlevel = \"error\"\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("reloadbad", "Music store web application").
+		WatchConfig().
+		Key("level", "info", "Log level", pungi.OneOf("debug", "info", "error")).
+		Key("rate", 10, "Rate limit").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+	p.RootConfig().OnConfigChange(func(keys []string) {
+		t.Error("Invalid config must not be reported")
+	})
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("[reloadbad]\nlevel = \"verbose\"\nrate = 20\n"), 0644))
+	err = p.Reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "reloadbad.level must be one of")
+
+	assert.Equal(t, "error", p.RootConfig().GetString("level"))
+	assert.Equal(t, 10, p.RootConfig().GetInt("rate"))
+}
+
+func TestReloadNeverExposesInvalidConfig(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[reloadstaged]\nlevel = \"error\"\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("reloadstaged", "Music store web application").
+		Key("level", "info", "Log level", pungi.OneOf("debug", "info", "error")).
+		Key("rate", 10, "Rate limit").
+		Run(startWebApp).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+	conf := p.RootConfig()
+	conf.Set("rate", 20)
+
+	done := make(chan struct{})
+	var seen []string
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			if level := conf.GetString("level"); level != "error" {
+				seen = append(seen, level)
+			}
+		}
+	}()
+	require.NoError(t, ioutil.WriteFile(file, []byte("[reloadstaged]\nlevel = \"verbose\"\n"), 0644))
+	for i := 0; i < 20; i++ {
+		require.Error(t, p.Reload())
+	}
+	<-done
+	assert.Empty(t, seen, "The invalid config is validated before it is used")
+	assert.Equal(t, 20, conf.GetInt("rate"), "Values set with Set are kept")
+}
+
+func TestWatchConfigFileChanges(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[watchapp]\nrate = 10\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("watchapp", "Music store web application").
+		WatchConfig().
+		Key("rate", 10, "Rate limit").
+		Run(func(conf *pungi.Conf, args []string) error {
+			changed := make(chan interface{}, 10)
+			conf.OnChange("rate", func(old, new interface{}) {
+				changed <- new
+			})
+			if err := ioutil.WriteFile(file, []byte("[watchapp]\nrate = 30\n"), 0644); err != nil {
+				return err
+			}
+			select {
+			case rate := <-changed:
+				assert.Equal(t, 30, rate)
+			case <-time.After(5 * time.Second):
+				t.Error("Config file change was not noticed")
+			}
+			return nil
+		}).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+	assert.Equal(t, 30, p.RootConfig().GetInt("rate"))
+}
+
+func TestWatchConfigReloadsOnSighup(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[hupapp]\nrate = 10\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := pungi.New("hupapp", "Music store web application").
+		WatchConfig().
+		Key("rate", 10, "Rate limit").
+		Run(func(conf *pungi.Conf, args []string) error {
+			changed := make(chan interface{}, 10)
+			conf.OnConfigChange(func(keys []string) {
+				changed <- keys
+			})
+			// Written before the watcher notices, the reload may also come from the file watcher.
+			if err := ioutil.WriteFile(file, []byte("[hupapp]\nrate = 40\n"), 0644); err != nil {
+				return err
+			}
+			process, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				return err
+			}
+			if err := process.Signal(syscall.SIGHUP); err != nil {
+				return err
+			}
+			select {
+			case keys := <-changed:
+				assert.Equal(t, []string{"rate"}, keys)
+			case <-time.After(5 * time.Second):
+				t.Error("Config was not reloaded")
+			}
+			return nil
+		}).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+	assert.Equal(t, 40, p.RootConfig().GetInt("rate"))
+}
+
+func TestReloadFindsConfigFileCreatedLater(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pungi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.toml")
+
+	p, err := pungi.New("hupnofile", "Music store web application").
+		WatchConfig().
+		ConfigSearchPath(file).
+		Key("rate", 10, "Rate limit").
+		Run(func(conf *pungi.Conf, args []string) error {
+			changed := make(chan interface{}, 10)
+			conf.OnChange("rate", func(old, new interface{}) {
+				changed <- new
+			})
+			if err := ioutil.WriteFile(file, []byte("[hupnofile]\nrate = 50\n"), 0644); err != nil {
+				return err
+			}
+			process, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				return err
+			}
+			if err := process.Signal(syscall.SIGHUP); err != nil {
+				return err
+			}
+			select {
+			case rate := <-changed:
+				assert.Equal(t, 50, rate)
+			case <-time.After(5 * time.Second):
+				t.Error("Config was not reloaded")
+			}
+			return nil
+		}).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute())
+	assert.Equal(t, 50, p.RootConfig().GetInt("rate"))
+	assert.Equal(t, []string{file}, p.ConfigFilesUsed())
+}
+
+func TestChangeListenersAreDroppedOnExecute(t *testing.T) {
+	file := writeTempConfig(t, "config.toml", "[reloadruns]\nrate = 10\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	var calls int
+	p, err := pungi.New("reloadruns", "Music store web application").
+		Key("rate", 10, "Rate limit").
+		Run(func(conf *pungi.Conf, args []string) error {
+			conf.OnChange("rate", func(old, new interface{}) {
+				calls++
+			})
+			return nil
+		}).
+		Initialize()
+	require.NoError(t, err)
+	require.NoError(t, p.Execute("--config="+file))
+	require.NoError(t, p.Execute("--config="+file))
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("[reloadruns]\nrate = 20\n"), 0644))
+	require.NoError(t, p.Reload())
+	assert.Equal(t, 1, calls, "Only the listener of the last run is called")
+}
@@ -0,0 +1,170 @@
+package pungi
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	flag "github.com/spf13/pflag"
+)
+
+// timeValue is a pflag value for `time.Time` keys. Accepts the same formats as the config file and env variables.
+type timeValue struct {
+	value *time.Time
+}
+
+func newTimeValue(val time.Time, p *time.Time) *timeValue {
+	*p = val
+	return &timeValue{value: p}
+}
+
+func (t *timeValue) Set(val string) error {
+	parsed, err := cast.StringToDate(val)
+	if err != nil {
+		return err
+	}
+	*t.value = parsed
+	return nil
+}
+
+func (t *timeValue) Type() string {
+	return "time"
+}
+
+func (t *timeValue) String() string {
+	if t.value.IsZero() {
+		return ""
+	}
+	return t.value.Format(time.RFC3339)
+}
+
+func timeVar(flags *flag.FlagSet, name string, value time.Time, usage string) {
+	flags.Var(newTimeValue(value, new(time.Time)), name, usage)
+}
+
+// Splits lists coming from env variables ("a,b") and flags ("[a,b]").
+// Values from the config file are already native lists.
+func toStringSlice(value interface{}) []string {
+	items, _ := toStringSliceE(value)
+	return items
+}
+
+func toStringSliceE(value interface{}) ([]string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return cast.ToStringSliceE(value)
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "["), "]")
+	if s == "" {
+		return []string{}, nil
+	}
+	items, err := csv.NewReader(strings.NewReader(s)).Read()
+	if err != nil {
+		items = strings.Split(s, ",")
+	}
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	return items, nil
+}
+
+func toIntSlice(value interface{}) []int {
+	items, _ := toIntSliceE(value)
+	return items
+}
+
+// Invalid items are zero, the error is about the first one.
+func toIntSliceE(value interface{}) ([]int, error) {
+	if _, ok := value.(string); !ok {
+		return cast.ToIntSliceE(value)
+	}
+	items, _ := toStringSliceE(value)
+	out := make([]int, 0, len(items))
+	var firstErr error
+	for _, item := range items {
+		i, err := cast.ToIntE(item)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		out = append(out, i)
+	}
+	return out, firstErr
+}
+
+// Maps coming from env variables and flags use "key=value" pairs: "a=1,b=2".
+func toStringMap(value interface{}) map[string]string {
+	m, _ := toStringMapE(value)
+	return m
+}
+
+// Pairs without "=" are skipped, the error is about the first one.
+func toStringMapE(value interface{}) (map[string]string, error) {
+	if _, ok := value.(string); !ok {
+		return cast.ToStringMapStringE(value)
+	}
+	out := make(map[string]string)
+	var firstErr error
+	for _, pair := range toStringSlice(value) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 {
+			out[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		} else if firstErr == nil {
+			firstErr = fmt.Errorf("expected key=value, got %q", pair)
+		}
+	}
+	return out, firstErr
+}
+
+// Converts a raw value to the type of `like`, e.g. the default value of a key.
+func convert(value, like interface{}) (interface{}, error) {
+	switch like.(type) {
+	case int:
+		return cast.ToIntE(value)
+	case int64:
+		return cast.ToInt64E(value)
+	case uint:
+		return cast.ToUintE(value)
+	case uint64:
+		return cast.ToUint64E(value)
+	case bool:
+		return cast.ToBoolE(value)
+	case float64:
+		return cast.ToFloat64E(value)
+	case time.Duration:
+		return cast.ToDurationE(value)
+	case time.Time:
+		return cast.ToTimeE(value)
+	case []string:
+		return toStringSliceE(value)
+	case []int:
+		return toIntSliceE(value)
+	case map[string]string:
+		return toStringMapE(value)
+	default:
+		return cast.ToStringE(value)
+	}
+}
+
+// ConversionError is returned by the `E` getters when the value can't be converted to the type of the getter.
+type ConversionError struct {
+	Key string
+	// Value as given in the flag, env variable or config file
+	Value  string
+	Type   string
+	Source Source
+	Err    error
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("Key %s: invalid %s value %q (from %s)", e.Key, e.Type, e.Value, e.Source)
+}
+
+func (e *ConversionError) Cause() error {
+	return e.Err
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
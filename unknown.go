@@ -0,0 +1,288 @@
+package pungi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// What to do with config file keys and sections that are not declared
+type unknownKeysMode int
+
+const (
+	ignoreUnknownKeys unknownKeysMode = iota
+	warnUnknownKeys
+	rejectUnknownKeys
+)
+
+// Rejects config files containing keys or sections that are not declared on the builder or any command.
+// The error lists every unknown key with a suggestion.
+func (p *pungiBuilder) Strict() *pungiBuilder {
+	p.unknownKeys = rejectUnknownKeys
+	return p
+}
+
+// Like `Strict`, but the unknown keys are only logged. Useful for gradual adoption.
+func (p *pungiBuilder) StrictWarn() *pungiBuilder {
+	p.unknownKeys = warnUnknownKeys
+	return p
+}
+
+// UnknownKey is a key or section of a config file that is not declared.
+type UnknownKey struct {
+	// Lowercase path in the file, e.g. `testapp.httpgw.dburi`. Env variable name for .env files.
+	Path   string
+	Source Source
+	// Did you mean suggestion, empty if there is none
+	Suggestion string
+}
+
+func (k UnknownKey) String() string {
+	if k.Suggestion == "" {
+		return fmt.Sprintf("%s (%s)", k.Path, k.Source)
+	}
+	return fmt.Sprintf("%s (%s), did you mean %s?", k.Path, k.Source, k.Suggestion)
+}
+
+// UnknownKeysError is returned in strict mode when config files contain keys that are not declared.
+type UnknownKeysError struct {
+	Keys []UnknownKey
+}
+
+func (e *UnknownKeysError) Error() string {
+	lines := make([]string, len(e.Keys))
+	for i, k := range e.Keys {
+		lines[i] = k.String()
+	}
+	return "Unknown config keys:\n  " + strings.Join(lines, "\n  ")
+}
+
+// Reports the unknown keys of the files as configured by `Strict` or `StrictWarn`.
+func (p *Pungi) checkUnknownKeys(files configFiles) error {
+	if p.unknownKeys == ignoreUnknownKeys {
+		return nil
+	}
+	var unknown []UnknownKey
+	for _, file := range files {
+		if file.env != nil {
+			unknown = append(unknown, p.unknownEnvKeys(file)...)
+			continue
+		}
+		app := strings.ToLower(p.appName)
+		for _, name := range sortedKeys(file.values.AllSettings()) {
+			if name != app {
+				unknown = append(unknown, p.unknownKey(file, name, []string{app}))
+			}
+		}
+		if section, ok := file.values.AllSettings()[app].(map[string]interface{}); ok {
+			unknown = append(unknown, p.unknownSectionKeys(file, []string{app}, "", section)...)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	err := &UnknownKeysError{Keys: unknown}
+	if p.unknownKeys == warnUnknownKeys {
+		p.logf(VerbosityInfo, "Warning: %v", err)
+		return nil
+	}
+	return err
+}
+
+// Section of a command or a profile section of a command.
+// cmdPath - command names in the section, empty for the app section
+func (p *Pungi) unknownSectionKeys(file *configFile, path []string, cmdPath string, section map[string]interface{}) []UnknownKey {
+	keys := p.sectionKeys(cmdPath)
+	subCommands := p.subCommands(cmdPath)
+	inProfile := len(path) >= 2 && path[len(path)-2] == profilesSection
+	var unknown []UnknownKey
+	for _, name := range sortedKeys(section) {
+		value := section[name]
+		sub, isSection := value.(map[string]interface{})
+		switch {
+		case keys[name] != "":
+			// Map keys are sections too
+		case isSection && name == profilesSection && !inProfile:
+			for _, profile := range sortedKeys(sub) {
+				if profileSection, ok := sub[profile].(map[string]interface{}); ok {
+					profilePath := append(append(append([]string(nil), path...), name), profile)
+					unknown = append(unknown, p.unknownSectionKeys(file, profilePath, cmdPath, profileSection)...)
+				} else {
+					unknown = append(unknown, p.unknownKey(file, strings.Join(append(path, name, profile), "."), nil))
+				}
+			}
+		case isSection && !inProfile && stringInSlice(name, subCommands):
+			subPath := strings.TrimSpace(cmdPath + " " + name)
+			unknown = append(unknown, p.unknownSectionKeys(file, append(append([]string(nil), path...), name), subPath, sub)...)
+		default:
+			candidates := make([]string, 0, len(keys)+len(subCommands))
+			for _, key := range keys {
+				candidates = append(candidates, key)
+			}
+			if !inProfile {
+				candidates = append(candidates, subCommands...)
+			}
+			unknown = append(unknown, p.unknownKey(file, strings.Join(append(path, name), "."), candidates))
+		}
+	}
+	return unknown
+}
+
+func (p *Pungi) unknownKey(file *configFile, path string, candidates []string) UnknownKey {
+	name := path[strings.LastIndex(path, ".")+1:]
+	k := UnknownKey{
+		Path:       path,
+		Source:     Source{Layer: LayerFile, Name: file.name, Line: file.line(path)},
+		Suggestion: suggest(name, candidates),
+	}
+	if k.Suggestion == "" {
+		k.Suggestion = p.otherSection(name)
+	}
+	return k
+}
+
+// Variables with the app prefix must be env variables of declared keys or built-in flags.
+func (p *Pungi) unknownEnvKeys(file *configFile) []UnknownKey {
+	known := make(map[string]bool)
+	for _, flag := range []string{"config", configFormatFlag, verbosityFlag, profileFlag} {
+		known[formatRootEnvKey(p.appName, strings.Replace(flag, "-", "_", -1))] = true
+	}
+	p.store.mu.RLock()
+	for _, k := range p.store.keys {
+		known[k.envKey] = true
+	}
+	p.store.mu.RUnlock()
+	envKeys := make([]string, 0, len(known))
+	for envKey := range known {
+		envKeys = append(envKeys, envKey)
+	}
+
+	var unknown []UnknownKey
+	prefix := strings.ToUpper(p.appName) + "_"
+	for _, name := range sortedKeys(file.env) {
+		if strings.HasPrefix(name, prefix) && !known[name] {
+			unknown = append(unknown, UnknownKey{
+				Path:       name,
+				Source:     Source{Layer: LayerEnv, Name: file.name, Line: file.envLines[name]},
+				Suggestion: suggest(name, envKeys),
+			})
+		}
+	}
+	return unknown
+}
+
+// Declared keys of the command and its subcommands by lowercase name.
+// The app section is shared by all commands.
+func (p *Pungi) sectionKeys(cmdPath string) map[string]string {
+	keys := make(map[string]string)
+	for name, conf := range p.confs {
+		if name == rootKey {
+			name = ""
+		}
+		if cmdPath == "" || name == cmdPath || strings.HasPrefix(name, cmdPath+" ") {
+			for key := range conf.keys {
+				keys[strings.ToLower(key)] = key
+			}
+		}
+	}
+	return keys
+}
+
+// Lowercase names of the direct subcommands
+func (p *Pungi) subCommands(cmdPath string) []string {
+	var names []string
+	for name := range p.confs {
+		if name == rootKey {
+			continue
+		}
+		parent, sub := "", name
+		if i := strings.LastIndex(name, " "); i >= 0 {
+			parent, sub = name[:i], name[i+1:]
+		}
+		if parent == cmdPath {
+			names = append(names, strings.ToLower(sub))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Suggests the section of another command that declares the key: `dbUri in [app.grpc]`
+func (p *Pungi) otherSection(name string) string {
+	var sections []string
+	for _, conf := range p.confs {
+		for key, k := range conf.keys {
+			if strings.EqualFold(key, name) && k.declared {
+				sections = append(sections, fmt.Sprintf("%s in [%s]", key, confSection(conf)))
+			}
+		}
+	}
+	if len(sections) == 0 {
+		return ""
+	}
+	sort.Strings(sections)
+	return sections[0]
+}
+
+// Returns the candidate closest to the name, empty if none is close enough.
+func suggest(name string, candidates []string) string {
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+	best, bestDistance := "", maxInt(2, len(name)/3)+1
+	for _, candidate := range sorted {
+		if d := levenshtein(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch v := m.(type) {
+	case map[string]interface{}:
+		for key := range v {
+			keys = append(keys, key)
+		}
+	case map[string]string:
+		for key := range v {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
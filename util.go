@@ -6,3 +6,12 @@ func firstWord(spaceSeparatedText string) string {
 	first := strings.Split(spaceSeparatedText, " ")[0]
 	return strings.TrimSpace(first)
 }
+
+func stringInSlice(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
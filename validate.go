@@ -0,0 +1,224 @@
+package pungi
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// KeyOption adds validation rules to a key. Rules are checked after the configuration is loaded,
+// before the runnable is called.
+type KeyOption func(k *key)
+
+type rule func(value interface{}) error
+
+// The key must be set by a flag, an env variable or the config file.
+func Required() KeyOption {
+	return func(k *key) {
+		k.required = true
+	}
+}
+
+// Numeric value (or duration, time) must be at least `min`. Other key types are rejected by `Initialize`.
+func Min(min interface{}) KeyOption {
+	return func(k *key) {
+		k.bounds = append(k.bounds, min)
+		k.rules = append(k.rules, func(value interface{}) error {
+			if compare(value, min) < 0 {
+				return errors.Errorf("must be at least %v, got %v", min, value)
+			}
+			return nil
+		})
+	}
+}
+
+// Numeric value (or duration, time) must be at most `max`. Other key types are rejected by `Initialize`.
+func Max(max interface{}) KeyOption {
+	return func(k *key) {
+		k.bounds = append(k.bounds, max)
+		k.rules = append(k.rules, func(value interface{}) error {
+			if compare(value, max) > 0 {
+				return errors.Errorf("must be at most %v, got %v", max, value)
+			}
+			return nil
+		})
+	}
+}
+
+// Formatted value must match the regular expression. Panics if the pattern is invalid.
+func Regex(pattern string) KeyOption {
+	re := regexp.MustCompile(pattern)
+	return func(k *key) {
+		k.rules = append(k.rules, func(value interface{}) error {
+			if !re.MatchString(valueString(value)) {
+				return errors.Errorf("must match %s, got %q", pattern, valueString(value))
+			}
+			return nil
+		})
+	}
+}
+
+// Formatted value must be one of the given values.
+func OneOf(values ...interface{}) KeyOption {
+	allowed := make([]string, len(values))
+	for i, v := range values {
+		allowed[i] = valueString(v)
+	}
+	return func(k *key) {
+		k.rules = append(k.rules, func(value interface{}) error {
+			s := valueString(value)
+			for _, a := range allowed {
+				if s == a {
+					return nil
+				}
+			}
+			return errors.Errorf("must be one of [%s], got %q", strings.Join(allowed, ", "), s)
+		})
+	}
+}
+
+// Custom validation. The value has the same type as the default value of the key.
+func Check(check func(value interface{}) error) KeyOption {
+	return func(k *key) {
+		k.rules = append(k.rules, check)
+	}
+}
+
+// Violation describes one key that failed validation.
+type Violation struct {
+	// Key name
+	Key string
+	// Full config file path, e.g. `testapp.httpgw.port`
+	ConfKey string
+	EnvKey  string
+	// Flag name with the dashes, empty if the key has no flag
+	Flag string
+	// Where the invalid value came from
+	Source  Source
+	Message string
+}
+
+func (v Violation) String() string {
+	section := v.ConfKey[:strings.LastIndex(v.ConfKey, ".")]
+	setWith := v.EnvKey
+	if v.Flag != "" {
+		setWith = v.Flag + ", " + setWith
+	}
+	return fmt.Sprintf("%s %s (from %s; set with %s or %s in [%s])",
+		v.ConfKey, v.Message, v.Source, setWith, v.Key, section)
+}
+
+// ValidationError contains all violations of one command configuration.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		lines[i] = v.String()
+	}
+	return "Invalid configuration:\n  " + strings.Join(lines, "\n  ")
+}
+
+// Checks every key defined for the command, defaults included. Returns `*ValidationError`.
+func (c *Conf) validate() error {
+	var violations []Violation
+	for _, name := range c.keyNames() {
+		k := c.keys[name]
+		violation := Violation{
+			Key:     k.name,
+			ConfKey: k.confKey,
+			EnvKey:  k.envKey,
+			Source:  c.store.source(k),
+		}
+		if k.flag != nil {
+			violation.Flag = "--" + k.flag.Name
+		}
+		if violation.Source.Layer == LayerDefault && k.required {
+			violation.Message = "is required"
+			violations = append(violations, violation)
+			continue
+		}
+		value, err := c.typedValue(k.key)
+		if err == nil {
+			for _, check := range k.rules {
+				if err = check(value); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			violation.Message = err.Error()
+			if c.store.isSensitive(k) {
+				violation.Message = redactMessage(violation.Message, c.value(k.name))
+			}
+			violations = append(violations, violation)
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// Min and Max compare numbers with numbers and times with times
+func validateBounds(k *key) error {
+	_, timeKey := k.value.(time.Time)
+	for _, bound := range k.bounds {
+		_, timeBound := bound.(time.Time)
+		if timeKey != timeBound || !timeKey && !(isNumber(k.value) && isNumber(bound)) {
+			return errors.Errorf("Key %s: Min and Max need numeric or time values, got %T and %T", k.name, k.value, bound)
+		}
+	}
+	return nil
+}
+
+func isNumber(value interface{}) bool {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// Compares numbers of any kind, durations included, or times. Other types are rejected by `validateBounds`.
+func compare(a, b interface{}) int {
+	if t, ok := a.(time.Time); ok {
+		u := b.(time.Time)
+		switch {
+		case t.Before(u):
+			return -1
+		case t.After(u):
+			return 1
+		}
+		return 0
+	}
+	x, y := toFloat(a), toFloat(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toFloat(value interface{}) float64 {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	default:
+		return rv.Float()
+	}
+}
@@ -0,0 +1,56 @@
+package pungi
+
+import (
+	"fmt"
+	"reflect"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Value is implemented by custom key types, e.g. urls, byte sizes or enums.
+// Pass a pointer to the default value to `Key` and read it back with `Conf.GetValue`.
+//
+// The interface is compatible with `pflag.Value`.
+type Value interface {
+	// Parses the value from a flag, an env variable or a config file value.
+	Set(string) error
+	// Formats the value. Used for the default value in help and for the config file.
+	String() string
+	// Type name shown in help.
+	Type() string
+}
+
+var _ flag.Value = Value(nil)
+
+// Every flag gets its own copy, so parsing a flag does not modify the default value of the key.
+func cloneValue(v Value) Value {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return v
+	}
+	c := reflect.New(rv.Elem().Type())
+	c.Elem().Set(rv.Elem())
+	return c.Interface().(Value)
+}
+
+// Copies a default of the same type into dst. Returns false if the types differ.
+func copyValue(dst Value, src interface{}) bool {
+	dv, sv := reflect.ValueOf(dst), reflect.ValueOf(src)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || sv.Kind() != reflect.Ptr || sv.IsNil() || dv.Type() != sv.Type() {
+		return false
+	}
+	dv.Elem().Set(sv.Elem())
+	return true
+}
+
+// Config files may contain native values (i.e. numbers), they are formatted before parsing.
+func valueString(raw interface{}) string {
+	switch v := raw.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
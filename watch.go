@@ -0,0 +1,284 @@
+package pungi
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// Reloads the config file when it changes or when the process receives SIGHUP. Config sources like `HTTPSource`
+// are reloaded when they change.
+// The new file is validated first, on failure the old configuration is kept.
+// Use `Conf.OnChange` to react to changes.
+func (p *pungiBuilder) WatchConfig() *pungiBuilder {
+	p.watchConfig = true
+	return p
+}
+
+// listener is a change callback registered on a Conf.
+type listener struct {
+	conf *Conf
+	// Empty for listeners of the whole configuration
+	key         string
+	onKeyChange func(old, new interface{})
+	onChange    func(changed []string)
+}
+
+// Calls `onChange` with the old and the new value when the key changes after a reload.
+// The values have the same type as the default value of the key.
+// Listeners are dropped when the next `Execute` starts, register them in the runnable.
+func (c *Conf) OnChange(key string, onChange func(old, new interface{})) {
+	c.store.addListener(&listener{conf: c, key: key, onKeyChange: onChange})
+}
+
+// Calls `onChange` with the names of the changed keys when any key of this configuration changes after a reload.
+func (c *Conf) OnConfigChange(onChange func(changed []string)) {
+	c.store.addListener(&listener{conf: c, onChange: onChange})
+}
+
+func (s *configStore) addListener(l *listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, l)
+}
+
+func (s *configStore) clearListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = nil
+}
+
+// Reloads the config files that were read. The config files are searched again, so a file created after the start
+// is read too. The new configuration is validated first, on failure the old configuration is kept
+// and the validation error is returned. Change listeners are called after a successful reload.
+func (p *Pungi) Reload() error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	p.store.mu.RLock()
+	old := p.store.files
+	p.store.mu.RUnlock()
+	if len(old) == 0 && p.findConfigFiles == nil {
+		return errors.New("No config file to reload")
+	}
+	files, err := p.rereadConfigFiles(old)
+	if err != nil {
+		return err
+	}
+	if err := p.checkUnknownKeys(files); err != nil {
+		return err
+	}
+
+	p.store.mu.RLock()
+	sources := p.store.sources
+	p.store.mu.RUnlock()
+	if err := p.useStaged(files, sources); err != nil {
+		return err
+	}
+	p.configFilesUsed = files.names()
+	if len(files) > 0 {
+		p.configFileUsed = files[len(files)-1].name
+	}
+	return nil
+}
+
+// Validates the config files and sources before they replace the current ones. On failure nothing is changed.
+// The caller holds `reloadMu`.
+func (p *Pungi) useStaged(files configFiles, sources []*sourceLayer) error {
+	staged, err := p.store.stage(files, sources)
+	if err != nil {
+		return err
+	}
+	if err := p.validateStore(staged); err != nil {
+		return err
+	}
+	before := p.snapshot()
+	p.store.swap(staged)
+	p.notify(before, p.snapshot())
+	return nil
+}
+
+// Finds the config files again, so new drop-in files are read. Without discovery the same files are read.
+func (p *Pungi) rereadConfigFiles(old configFiles) (configFiles, error) {
+	if p.findConfigFiles != nil {
+		return p.findConfigFiles()
+	}
+	files := make(configFiles, len(old))
+	for i, oldFile := range old {
+		file, err := readConfigFile(oldFile.name, oldFile.format)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = file
+	}
+	return files, nil
+}
+
+// Validates every command configuration, violations are aggregated.
+func (p *Pungi) validate() error {
+	return p.validateStore(p.store)
+}
+
+// store - the store of the Pungi or a staged copy
+func (p *Pungi) validateStore(store *configStore) error {
+	confs, err := p.selectConfs(nil)
+	if err != nil {
+		return err
+	}
+	validationErr := &ValidationError{}
+	for _, conf := range confs {
+		if err := conf.withStore(store).validate(); err != nil {
+			validationErr.Violations = append(validationErr.Violations, err.(*ValidationError).Violations...)
+		}
+	}
+	if len(validationErr.Violations) > 0 {
+		return validationErr
+	}
+	return nil
+}
+
+// Typed values of every declared key by config
+func (p *Pungi) snapshot() map[*Conf]map[string]interface{} {
+	values := make(map[*Conf]map[string]interface{})
+	for _, conf := range p.confs {
+		values[conf] = make(map[string]interface{})
+		for name, k := range conf.keys {
+			values[conf][name], _ = conf.typedValue(k.key)
+		}
+	}
+	return values
+}
+
+func (p *Pungi) notify(before, after map[*Conf]map[string]interface{}) {
+	p.store.mu.RLock()
+	listeners := append([]*listener(nil), p.store.listeners...)
+	p.store.mu.RUnlock()
+
+	for _, l := range listeners {
+		if l.key != "" {
+			old, new := before[l.conf][l.key], after[l.conf][l.key]
+			if !reflect.DeepEqual(old, new) {
+				l.onKeyChange(old, new)
+			}
+			continue
+		}
+		var changed []string
+		for _, name := range l.conf.keyNames() {
+			if !reflect.DeepEqual(before[l.conf][name], after[l.conf][name]) {
+				changed = append(changed, name)
+			}
+		}
+		if len(changed) > 0 {
+			l.onChange(changed)
+		}
+	}
+}
+
+// watcher reloads the config file on file changes and SIGHUP
+type watcher struct {
+	// Nil without config files
+	files   *fsnotify.Watcher
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+func (p *Pungi) startWatching() error {
+	if p.watcher != nil {
+		return nil
+	}
+	w := &watcher{
+		signals: make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+	fileNames := make(map[string]bool)
+	// Nil channels without config files, then only SIGHUP and the config sources reload
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if len(p.store.files) > 0 {
+		files, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		for _, file := range p.store.files {
+			fileName := filepath.Clean(file.name)
+			fileNames[fileName] = true
+			// Editors often replace the file, so the directory is watched.
+			if err := files.Add(filepath.Dir(fileName)); err != nil {
+				_ = files.Close()
+				return err
+			}
+			// Drop-in files may be added and removed
+			if dropIns := filepath.Join(filepath.Dir(fileName), confDirName); isDir(dropIns) {
+				if err := files.Add(dropIns); err != nil {
+					_ = files.Close()
+					return err
+				}
+			}
+		}
+		w.files = files
+		events, errs = files.Events, files.Errors
+	}
+	signal.Notify(w.signals, syscall.SIGHUP)
+	p.watcher = w
+	p.watchSources(w.done)
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				name := filepath.Clean(event.Name)
+				if fileNames[name] && event.Op&(fsnotify.Write|fsnotify.Create) != 0 || isDropIn(name) {
+					p.reloadAndReport()
+				}
+			case err, ok := <-errs:
+				if !ok {
+					return
+				}
+				p.logf(VerbosityInfo, "Config file watcher error: %v", err)
+			case <-w.signals:
+				p.reloadAndReport()
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func isDropIn(path string) bool {
+	return filepath.Base(filepath.Dir(path)) == confDirName && filepath.Ext(path) == ".toml"
+}
+
+func (p *Pungi) stopWatching() {
+	if p.watcher == nil {
+		return
+	}
+	signal.Stop(p.watcher.signals)
+	close(p.watcher.done)
+	if p.watcher.files != nil {
+		_ = p.watcher.files.Close()
+	}
+	p.watcher = nil
+}
+
+func (p *Pungi) reloadAndReport() {
+	if err := p.Reload(); err != nil {
+		p.logf(VerbosityInfo, "Could not reload config from %s, keeping the old config\n Error: %v", strings.Join(p.configFilesUsed, ", "), err)
+	} else {
+		p.logf(VerbosityInfo, "Reloaded config from %s", strings.Join(p.configFilesUsed, ", "))
+	}
+}